@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"ollama-api-proxy/src/internal/catalog"
 	"ollama-api-proxy/src/internal/config"
 	"ollama-api-proxy/src/internal/core"
 	"ollama-api-proxy/src/internal/state"
@@ -23,14 +24,15 @@ var testRouter *gin.Engine
 func TestMain(m *testing.M) {
 	gin.SetMode(gin.TestMode)
 	// Init test configuration
-	envConfig := initConfig()
+	envConfig := initConfig(&options{})
 	models, _ := config.LoadModels("models.yaml")
 
 	appState := &state.State{
-		Config:     envConfig,
 		HttpClient: &http.Client{},
-		Models:     models,
 	}
+	appState.SetConfig(envConfig)
+	appState.SetModels(models)
+	appState.Catalog = catalog.New(appState.Config, appState.HttpClient)
 
 	testRouter = core.InitRouterEngine(appState)
 
@@ -77,4 +79,21 @@ func performRequest(router *gin.Engine, req *http.Request) *http.Response {
 func TestVersionAPI(t *testing.T) {
 	resp := performRequest(testRouter, makeJSONRequest("GET", "/api/version", nil, nil))
 	assert.Equal(t, 200, resp.StatusCode, "Expected status code 200")
-}
\ No newline at end of file
+}
+
+func TestRequestID(t *testing.T) {
+	resp := performRequest(testRouter, makeJSONRequest("GET", "/api/version", nil, map[string]string{"X-Request-ID": "abc-123"}))
+	assert.Equal(t, "abc-123", resp.Header.Get("X-Request-ID"), "Request ID should be propagated")
+
+	resp = performRequest(testRouter, makeJSONRequest("GET", "/api/version", nil, nil))
+	assert.Len(t, resp.Header.Get("X-Request-ID"), 32, "Request ID should be generated")
+}
+
+func TestLoadModelsMissingFile(t *testing.T) {
+	models, err := loadModels("missing.yml", false)
+	assert.NoError(t, err, "A missing models file should not fail startup")
+	assert.Empty(t, models.Models)
+
+	_, err = models.GetModel("o3")
+	assert.Error(t, err)
+}
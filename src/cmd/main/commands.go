@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"ollama-api-proxy/src/internal/catalog"
+	"ollama-api-proxy/src/internal/config"
+	"ollama-api-proxy/src/internal/constants"
+
+	"gopkg.in/yaml.v3"
+)
+
+func usage() {
+	fmt.Fprint(os.Stderr, `Usage: ollama-api-proxy [command] [flags]
+
+Commands:
+  serve     run the proxy (default)
+  validate  check the config and models files and report every problem
+  models    print the effective model configuration
+  version   print the version
+
+Run 'ollama-api-proxy <command> -h' for the flags of a command.
+`)
+}
+
+// newFlagSet returns a flag set with the flags shared by every command that
+// reads the configuration, parsed into opts.
+func newFlagSet(name string, opts *options) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.StringVar(&opts.configFile, "config", "", "path to a YAML or TOML config file (default $PROXY_CONFIG)")
+	flags.StringVar(&opts.modelsPath, "models", "models.yml", "path to the models file")
+	return flags
+}
+
+func runServe(args []string) {
+	var opts options
+	flags := newFlagSet("serve", &opts)
+	flags.StringVar(&opts.listenAddr, "listen", "", "listen address as host:port, overriding PROXY_HOST and PROXY_PORT")
+	flags.Parse(args)
+	serve(&opts)
+}
+
+// runValidate checks the configuration and the models file without starting
+// the server and reports to out. It returns a non-zero exit code when either
+// is invalid.
+func runValidate(args []string, out io.Writer) int {
+	var opts options
+	flags := newFlagSet("validate", &opts)
+	printConfig := flags.Bool("print-config", false, "print the effective configuration with secrets masked")
+	flags.Parse(args)
+
+	failed := false
+	cfg, err := opts.loadConfig()
+	if err == nil {
+		_, err = catalog.NewFilter(cfg)
+	}
+	if err != nil {
+		fmt.Fprintf(out, "config: %v\n", err)
+		failed = true
+	} else {
+		fmt.Fprintln(out, "config: ok")
+	}
+
+	models, err := config.LoadModels(opts.modelsPath)
+	var modelsErr *config.ModelsError
+	switch {
+	case errors.As(err, &modelsErr):
+		for _, issue := range modelsErr.Issues {
+			fmt.Fprintf(out, "%s:%d: %s\n", modelsErr.Path, issue.Line, issue.Message)
+		}
+		failed = true
+	case err != nil:
+		fmt.Fprintf(out, "%s: %v\n", opts.modelsPath, err)
+		failed = true
+	default:
+		fmt.Fprintf(out, "%s: ok (%d bases, %d models)\n", opts.modelsPath, len(models.Bases), len(models.Models))
+	}
+
+	if *printConfig && cfg != nil {
+		masked, err := yaml.Marshal(cfg.Masked())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to print configuration: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(out, "\n%s", masked)
+	}
+
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// modelRow is the effective configuration of one model as printed by the
+// models command.
+type modelRow struct {
+	Name         string   `json:"name"`
+	Upstream     string   `json:"upstream"`
+	Base         string   `json:"base,omitempty"`
+	Capabilities []string `json:"capabilities"`
+	InputTokens  int      `json:"input_tokens"`
+	OutputTokens int      `json:"output_tokens"`
+	Aliases      []string `json:"aliases,omitempty"`
+}
+
+// runModels prints the models of the models file with inheritance applied
+// to out.
+func runModels(args []string, out io.Writer) int {
+	var opts options
+	flags := newFlagSet("models", &opts)
+	asJSON := flags.Bool("json", false, "print the models as JSON")
+	flags.Parse(args)
+
+	models, err := config.LoadModels(opts.modelsPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if models == nil {
+			return 1
+		}
+	}
+
+	rows := make([]modelRow, 0, len(models.Models))
+	for i := range models.Models {
+		info := &models.Models[i]
+		row := modelRow{
+			Name:         info.Name,
+			Upstream:     info.GetUpstreamName(),
+			InputTokens:  info.GetInputTokens(),
+			OutputTokens: info.GetOutputTokens(),
+			Aliases:      info.Aliases,
+		}
+		if info.Base != nil {
+			row.Base = *info.Base
+		}
+		for _, capability := range info.GetCapabilities() {
+			row.Capabilities = append(row.Capabilities, capability.String())
+		}
+		rows = append(rows, row)
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(rows); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to print models: %v\n", err)
+			return 1
+		}
+	} else {
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tUPSTREAM\tBASE\tCAPABILITIES\tINPUT\tOUTPUT\tALIASES")
+		for _, row := range rows {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%d\t%s\n", row.Name, row.Upstream, row.Base,
+				strings.Join(row.Capabilities, ","), row.InputTokens, row.OutputTokens, strings.Join(row.Aliases, ","))
+		}
+		w.Flush()
+	}
+
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+func runVersion() {
+	fmt.Printf("ollama-api-proxy %s (Ollama API %s)\n", constants.Version, constants.OllamaAPIVersion)
+}
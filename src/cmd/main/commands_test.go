@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const commandModels = `
+models:
+  - name: "fast"
+    upstream_name: "gpt-4.1-mini"
+    aliases: ["quick"]
+    config:
+      capabilities: ["completion", "tools"]
+      input_tokens: 1000
+`
+
+// writeFile writes content to name in a temporary directory and returns
+// its path.
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestRunValidate(t *testing.T) {
+	configPath := writeFile(t, "config.yml", "port: 9090\nopenai_api_key: sk-secret\n")
+	modelsPath := writeFile(t, "models.yml", commandModels)
+
+	var out bytes.Buffer
+	code := runValidate([]string{"-config", configPath, "-models", modelsPath, "-print-config"}, &out)
+	assert.Equal(t, 0, code, out.String())
+	assert.Contains(t, out.String(), "config: ok\n")
+	assert.Contains(t, out.String(), modelsPath+": ok (0 bases, 1 models)\n")
+	assert.Contains(t, out.String(), "port: 9090")
+	assert.NotContains(t, out.String(), "sk-secret", "Secrets should be masked")
+
+	invalidConfig := writeFile(t, "config.yml", "prot: 9090\n")
+	invalidModels := writeFile(t, "models.yml", "models:\n  - name: \"fast\"\n    config:\n      input_tokens: -1\n")
+	out.Reset()
+	code = runValidate([]string{"-config", invalidConfig, "-models", invalidModels}, &out)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, out.String(), "config: unknown key 'prot'")
+	assert.Contains(t, out.String(), invalidModels+":4: models[0].config.input_tokens")
+}
+
+// failingWriter fails every write.
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("closed")
+}
+
+func TestRunModels(t *testing.T) {
+	modelsPath := writeFile(t, "models.yml", commandModels)
+
+	var out bytes.Buffer
+	require.Equal(t, 0, runModels([]string{"-models", modelsPath, "-json"}, &out))
+	var rows []modelRow
+	require.NoError(t, json.Unmarshal(out.Bytes(), &rows))
+	assert.Equal(t, []modelRow{{
+		Name:         "fast",
+		Upstream:     "gpt-4.1-mini",
+		Capabilities: []string{"completion", "tools"},
+		InputTokens:  1000,
+		Aliases:      []string{"quick"},
+	}}, rows)
+
+	out.Reset()
+	require.Equal(t, 0, runModels([]string{"-models", modelsPath}, &out))
+	assert.Contains(t, out.String(), "NAME  UPSTREAM      BASE  CAPABILITIES")
+	assert.Contains(t, out.String(), "fast  gpt-4.1-mini")
+
+	assert.Equal(t, 1, runModels([]string{"-models", modelsPath, "-json"}, failingWriter{}), "Write errors should fail the command")
+	assert.Equal(t, 1, runModels([]string{"-models", filepath.Join(t.TempDir(), "missing.yml")}, &out))
+}
@@ -1,20 +1,108 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"log/slog"
-	"net/http"
+	"net"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"ollama-api-proxy/src/internal/cache"
+	"ollama-api-proxy/src/internal/capture"
+	"ollama-api-proxy/src/internal/catalog"
 	"ollama-api-proxy/src/internal/config"
+	"ollama-api-proxy/src/internal/conversation"
 	"ollama-api-proxy/src/internal/core"
 	"ollama-api-proxy/src/internal/state"
+	"ollama-api-proxy/src/internal/telemetry"
+	"ollama-api-proxy/src/internal/tokenizer"
 
 	"github.com/joho/godotenv"
 )
 
 var logLevel = new(slog.LevelVar)
 
-func initConfig() *config.Config {
+const envPath = ".env"
+
+// options are the command-line settings of a command.
+type options struct {
+	// configFile is the optional YAML or TOML config file, set by -config
+	// or PROXY_CONFIG.
+	configFile string
+	modelsPath string
+	// listenAddr overrides the configured host and port when set by -listen.
+	listenAddr string
+}
+
+// envFromFile records the variables set from the .env file, so a reload
+// can update them without overriding the real environment.
+var envFromFile = map[string]bool{}
+
+func loadEnvFile() error {
+	values, err := godotenv.Read(envPath)
+	if err != nil {
+		return err
+	}
+	for key := range envFromFile {
+		if _, ok := values[key]; !ok {
+			os.Unsetenv(key)
+			delete(envFromFile, key)
+		}
+	}
+	for key, value := range values {
+		if _, exists := os.LookupEnv(key); exists && !envFromFile[key] {
+			continue
+		}
+		os.Setenv(key, value)
+		envFromFile[key] = true
+	}
+	return nil
+}
+
+// loadConfig reads the .env file, the config file and the environment, and
+// applies the command-line overrides. It is also used for reloads.
+func (o *options) loadConfig() (*config.Config, error) {
+	if err := loadEnvFile(); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error loading .env file: %w", err)
+	}
+	if o.configFile == "" {
+		o.configFile = os.Getenv("PROXY_CONFIG")
+	}
+	cfg, err := config.LoadConfig(o.configFile)
+	if err != nil {
+		return nil, err
+	}
+	if o.listenAddr != "" {
+		host, port, err := net.SplitHostPort(o.listenAddr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid listen address %q: %w", o.listenAddr, err)
+		}
+		if cfg.Port, err = strconv.Atoi(port); err != nil {
+			return nil, fmt.Errorf("invalid listen port %q: %w", port, err)
+		}
+		cfg.Host = host
+	}
+	return cfg, nil
+}
+
+// setLogLevel applies the log level of a reloaded configuration.
+func setLogLevel(config *config.Config) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(config.LogLevel)); err != nil {
+		slog.Error("Invalid log level", "level", config.LogLevel, "error", err)
+		return
+	}
+	logLevel.Set(level)
+}
+
+func initConfig(opts *options) *config.Config {
 	// Initialize the log level with a default value
 	logLevel.Set(slog.LevelInfo)
 	h := slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
@@ -22,17 +110,8 @@ func initConfig() *config.Config {
 	})
 	slog.SetDefault(slog.New(h))
 
-	// Load environment variables from .env file
-	if err := godotenv.Load(); err != nil {
-		// Skip error if .env file is not found
-		if !os.IsNotExist(err) {
-			slog.Error("Error loading .env file", "error", err)
-			panic(err)
-		}
-	}
-
-	// Load config
-	config, err := config.LoadConfig()
+	// Load config from .env, the config file and the environment
+	config, err := opts.loadConfig()
 	if err != nil {
 		slog.Error("Failed to load configuration", "error", err)
 		panic(err)
@@ -45,22 +124,133 @@ func initConfig() *config.Config {
 		panic(err)
 	}
 	logLevel.Set(level)
+
+	if config.LogFormat == "json" {
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+			Level: logLevel,
+		})))
+	}
 	return config
 }
 
 func main() {
-	// Run the application
-	cfg := initConfig()
-	models, _ := config.LoadModels("models.yml")
+	args := os.Args[1:]
+	command := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+		runServe(args)
+	case "validate":
+		os.Exit(runValidate(args, os.Stdout))
+	case "models":
+		os.Exit(runModels(args, os.Stdout))
+	case "version":
+		runVersion()
+	case "help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", command)
+		usage()
+		os.Exit(2)
+	}
+}
+
+// loadModels loads the models file at startup. Without a models file no
+// models are configured; with lenient set, a file that fails validation is
+// used as far as it is valid.
+func loadModels(path string, lenient bool) (*config.Models, error) {
+	models, err := config.LoadModels(path)
+	var modelsErr *config.ModelsError
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		slog.Warn("Models file not found, continuing without configured models", "path", path)
+		return &config.Models{}, nil
+	case lenient && errors.As(err, &modelsErr):
+		slog.Warn("Models file has errors, continuing because models_lenient is set", "path", path, "error", err)
+		return models, nil
+	}
+	return models, err
+}
+
+// serve runs the proxy until it receives SIGINT or SIGTERM. In-flight
+// requests are drained before tracing, capture and the cache shut down.
+func serve(opts *options) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg := initConfig(opts)
+	models, err := loadModels(opts.modelsPath, cfg.ModelsLenient)
+	if err != nil {
+		slog.Error("Failed to load models", "path", opts.modelsPath, "error", err)
+		panic(err)
+	}
+
+	shutdownTracing, err := telemetry.Init(context.Background(), cfg)
+	if err != nil {
+		slog.Error("Failed to initialize tracing", "error", err)
+		panic(err)
+	}
+	defer func() {
+		// Flush the spans of the drained requests.
+		flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			slog.Warn("Failed to shut down tracing", "error", err)
+		}
+	}()
+
+	recorder, err := capture.New(cfg)
+	if err != nil {
+		slog.Error("Failed to initialize capture", "error", err)
+		panic(err)
+	}
+	defer recorder.Close()
+
+	responseCache, err := cache.New(cfg)
+	if err != nil {
+		slog.Error("Failed to initialize response cache", "error", err)
+		panic(err)
+	}
+
+	visibility, err := catalog.NewFilter(cfg)
+	if err != nil {
+		slog.Error("Invalid model visibility configuration", "error", err)
+		panic(err)
+	}
 
 	appState := &state.State{
-		Config: cfg,
-		Models: models,
-		HttpClient: &http.Client{
-			Timeout: cfg.Timeout,
-		},
+		HttpClient: core.NewHttpClient(),
+		Capture:    recorder,
+		Cache:      responseCache,
+		Tokenizer:  tokenizer.New(cfg.TokenizerDir),
+
+		Conversations: conversation.NewStore(cfg.ResponsesStoreSize, cfg.ResponsesStoreTTL),
+	}
+	appState.SetConfig(cfg)
+	appState.SetModels(models)
+	appState.SetVisibility(visibility)
+	appState.Catalog = catalog.New(appState.Config, appState.HttpClient)
+	appState.Catalog.Start(ctx)
+
+	reloader := &core.Reloader{
+		State:       appState,
+		ModelsPath:  opts.modelsPath,
+		ConfigPaths: []string{envPath, opts.configFile},
+		LoadConfig:  opts.loadConfig,
+		OnConfig:    setLogLevel,
 	}
-	
+	go func() {
+		if err := reloader.Watch(ctx); err != nil {
+			slog.Error("Failed to watch configuration files", "error", err)
+		}
+	}()
+
 	engine := core.InitRouterEngine(appState)
-	core.Run(engine, cfg)
+	if err := core.Run(ctx, engine, cfg); err != nil {
+		panic(err)
+	}
+	slog.Info("Server stopped")
 }
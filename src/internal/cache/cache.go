@@ -0,0 +1,169 @@
+// cache package stores upstream responses of deterministic requests.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"ollama-api-proxy/src/internal/config"
+	"ollama-api-proxy/src/internal/lru"
+)
+
+// Entry is a cached upstream response. For streaming requests Body holds
+// the raw SSE stream so it can be replayed chunk by chunk.
+type Entry struct {
+	Stream  bool      `json:"stream"`
+	Body    []byte    `json:"body"`
+	Created time.Time `json:"created"`
+}
+
+type Store interface {
+	Get(key string) (*Entry, bool)
+	Set(key string, entry *Entry)
+}
+
+// New returns the store selected by the configuration, or nil when caching
+// is disabled.
+func New(cfg *config.Config) (Store, error) {
+	switch cfg.CacheMode {
+	case "memory":
+		return lru.New[*Entry](cfg.CacheSize, cfg.CacheTTL), nil
+	case "disk":
+		if err := os.MkdirAll(cfg.CacheDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create cache dir: %w", err)
+		}
+		return &diskStore{dir: cfg.CacheDir, ttl: cfg.CacheTTL, maxSize: int64(cfg.CacheMaxSize) << 20}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// Key returns the canonical hash of a translated upstream request payload.
+// The upstream URL and API key are part of the hash, so responses of one
+// provider or account are not served after a reload switches to another.
+func Key(cfg *config.Config, payload []byte) string {
+	h := sha256.New()
+	h.Write([]byte(cfg.OpenAIBaseURL))
+	h.Write([]byte{0})
+	h.Write([]byte(cfg.OpenAIAPIKey))
+	h.Write([]byte{0})
+	h.Write(payload)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func expired(entry *Entry, ttl time.Duration) bool {
+	return ttl > 0 && time.Since(entry.Created) > ttl
+}
+
+// diskStore keeps one JSON file per entry. The modification time of a file
+// is when it was last used, so the least recently used entries are evicted
+// once the files exceed maxSize bytes.
+type diskStore struct {
+	dir     string
+	ttl     time.Duration
+	maxSize int64
+
+	// evictMu keeps concurrent writers from evicting the same files.
+	evictMu sync.Mutex
+}
+
+func (s *diskStore) path(key string) string {
+	return filepath.Join(s.dir, key+".json")
+}
+
+func (s *diskStore) Get(key string) (*Entry, bool) {
+	data, err := os.ReadFile(s.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		slog.Warn("Corrupt cache entry", "key", key, "error", err)
+		os.Remove(s.path(key))
+		return nil, false
+	}
+	if expired(&entry, s.ttl) {
+		os.Remove(s.path(key))
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(s.path(key), now, now)
+	return &entry, true
+}
+
+func (s *diskStore) Set(key string, entry *Entry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	// Write to a temporary file first so readers never see a partial entry.
+	tmp, err := os.CreateTemp(s.dir, key+".*.tmp")
+	if err != nil {
+		slog.Warn("Failed to write cache entry", "key", key, "error", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	tmp.Close()
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		slog.Warn("Failed to write cache entry", "key", key, "error", err)
+		return
+	}
+	if s.maxSize > 0 {
+		s.evict()
+	}
+}
+
+// evict removes the least recently used entries until the cache fits
+// maxSize.
+func (s *diskStore) evict() {
+	s.evictMu.Lock()
+	defer s.evictMu.Unlock()
+
+	dirEntries, err := os.ReadDir(s.dir)
+	if err != nil {
+		slog.Warn("Failed to list cache entries", "error", err)
+		return
+	}
+	var files []fs.FileInfo
+	var total int64
+	for _, dirEntry := range dirEntries {
+		if filepath.Ext(dirEntry.Name()) != ".json" {
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, info)
+		total += info.Size()
+	}
+	if total <= s.maxSize {
+		return
+	}
+
+	slices.SortFunc(files, func(a, b fs.FileInfo) int {
+		return a.ModTime().Compare(b.ModTime())
+	})
+	for _, file := range files {
+		if total <= s.maxSize {
+			break
+		}
+		if err := os.Remove(filepath.Join(s.dir, file.Name())); err == nil || errors.Is(err, fs.ErrNotExist) {
+			total -= file.Size()
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ollama-api-proxy/src/internal/config"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiskEviction(t *testing.T) {
+	entry := &Entry{Body: make([]byte, 100), Created: time.Now()}
+	data, _ := json.Marshal(entry)
+	// Four entries fit, a fifth does not.
+	store := &diskStore{dir: t.TempDir(), maxSize: int64(len(data)) * 9 / 2}
+
+	for i, key := range []string{"a", "b", "c", "d"} {
+		store.Set(key, entry)
+		old := time.Now().Add(time.Duration(i-10) * time.Minute)
+		os.Chtimes(store.path(key), old, old)
+	}
+	_, ok := store.Get("a")
+	assert.True(t, ok)
+	store.Set("e", entry)
+
+	_, err := os.Stat(store.path("b"))
+	assert.ErrorIs(t, err, os.ErrNotExist, "The least recently used entry should be evicted")
+	for _, key := range []string{"a", "c", "d", "e"} {
+		_, ok := store.Get(key)
+		assert.True(t, ok, key)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(store.dir, "*.json"))
+	var total int64
+	for _, file := range files {
+		info, _ := os.Stat(file)
+		total += info.Size()
+	}
+	assert.LessOrEqual(t, total, store.maxSize)
+}
+
+func TestKey(t *testing.T) {
+	cfg := config.Default()
+	cfg.OpenAIAPIKey = "sk-one"
+	payload := []byte(`{"model":"gpt-4.1","temperature":0}`)
+	key := Key(cfg, payload)
+	assert.Equal(t, key, Key(cfg, payload))
+
+	other := *cfg
+	other.OpenAIAPIKey = "sk-two"
+	assert.NotEqual(t, key, Key(&other, payload), "Another account should not share entries")
+	other = *cfg
+	other.OpenAIBaseURL = "https://example.com/v1"
+	assert.NotEqual(t, key, Key(&other, payload), "Another provider should not share entries")
+}
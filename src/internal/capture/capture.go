@@ -0,0 +1,203 @@
+// capture package records upstream request and response bodies to rotating
+// JSONL files for debugging.
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"ollama-api-proxy/src/internal/config"
+)
+
+const redacted = "[REDACTED]"
+
+// Record is a single captured exchange, written as one JSONL line.
+type Record struct {
+	Time      time.Time       `json:"time"`
+	RequestID string          `json:"request_id,omitempty"`
+	Path      string          `json:"path"`
+	Model     string          `json:"model"`
+	Stream    bool            `json:"stream"`
+	Status    int             `json:"status"`
+	Request   json.RawMessage `json:"request"`
+	Response  json.RawMessage `json:"response,omitempty"`
+}
+
+// Recorder writes records to size-rotated files in a directory.
+type Recorder struct {
+	enabled    bool
+	dir        string
+	maxSize    int64
+	maxFiles   int
+	sampleRate float64
+	redact     []*regexp.Regexp
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func New(cfg *config.Config) (*Recorder, error) {
+	r := &Recorder{
+		enabled:    cfg.CaptureEnabled,
+		dir:        cfg.CaptureDir,
+		maxSize:    int64(cfg.CaptureMaxSize) << 20,
+		maxFiles:   cfg.CaptureMaxFiles,
+		sampleRate: cfg.CaptureSampleRate,
+	}
+	for _, pattern := range cfg.CaptureRedact {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid capture redact pattern %q: %w", pattern, err)
+		}
+		r.redact = append(r.redact, re)
+	}
+	return r, nil
+}
+
+// ShouldCapture reports whether an exchange for a model should be recorded.
+// The per-model flag overrides the global setting; the sample rate applies
+// to both.
+func (r *Recorder) ShouldCapture(modelFlag *bool) bool {
+	if r == nil {
+		return false
+	}
+	enabled := r.enabled
+	if modelFlag != nil {
+		enabled = *modelFlag
+	}
+	if !enabled {
+		return false
+	}
+	return r.sampleRate >= 1 || rand.Float64() < r.sampleRate
+}
+
+// Write redacts and appends a record, rotating the file when it grows past
+// the configured size.
+func (r *Recorder) Write(rec *Record) {
+	rec.Request = r.redactJSON(asJSON(rec.Request))
+	rec.Response = r.redactJSON(asJSON(rec.Response))
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		slog.Warn("Failed to marshal capture record", "error", err)
+		return
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil || (r.maxSize > 0 && r.size+int64(len(line)) > r.maxSize) {
+		if err := r.rotate(); err != nil {
+			slog.Warn("Failed to rotate capture file", "error", err)
+			return
+		}
+	}
+
+	n, err := r.file.Write(line)
+	r.size += int64(n)
+	if err != nil {
+		slog.Warn("Failed to write capture record", "error", err)
+	}
+}
+
+func (r *Recorder) rotate() error {
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return err
+	}
+
+	name := filepath.Join(r.dir, fmt.Sprintf("capture-%s.jsonl", time.Now().UTC().Format("20060102T150405.000000000")))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	r.file = f
+	r.size = 0
+
+	if r.maxFiles > 0 {
+		files, _ := filepath.Glob(filepath.Join(r.dir, "capture-*.jsonl"))
+		slices.Sort(files)
+		for len(files) > r.maxFiles {
+			os.Remove(files[0])
+			files = files[1:]
+		}
+	}
+	return nil
+}
+
+// asJSON keeps valid JSON as is and stores anything else as a JSON string.
+func asJSON(b []byte) json.RawMessage {
+	if len(b) == 0 || json.Valid(b) {
+		return b
+	}
+	s, _ := json.Marshal(string(b))
+	return s
+}
+
+// redactJSON masks the redact patterns in the string values of a JSON
+// document. Matching the values rather than the encoded line keeps
+// patterns that match quotes or backslashes from breaking the record.
+func (r *Recorder) redactJSON(b json.RawMessage) json.RawMessage {
+	if len(r.redact) == 0 || len(b) == 0 {
+		return b
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return b
+	}
+	out, err := json.Marshal(r.redactValue(v))
+	if err != nil {
+		return b
+	}
+	return out
+}
+
+func (r *Recorder) redactValue(v any) any {
+	switch v := v.(type) {
+	case string:
+		for _, re := range r.redact {
+			v = re.ReplaceAllString(v, redacted)
+		}
+		return v
+	case []any:
+		for i, item := range v {
+			v[i] = r.redactValue(item)
+		}
+	case map[string]any:
+		for key, item := range v {
+			v[key] = r.redactValue(item)
+		}
+	}
+	return v
+}
+
+// Close closes the current capture file.
+func (r *Recorder) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
@@ -0,0 +1,109 @@
+package capture
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ollama-api-proxy/src/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRecorder(t *testing.T, configure func(cfg *config.Config)) *Recorder {
+	t.Helper()
+	cfg := config.Default()
+	cfg.CaptureEnabled = true
+	cfg.CaptureDir = t.TempDir()
+	if configure != nil {
+		configure(cfg)
+	}
+	r, err := New(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func captureFiles(t *testing.T, r *Recorder) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(r.dir, "capture-*.jsonl"))
+	require.NoError(t, err)
+	return files
+}
+
+func TestRedact(t *testing.T) {
+	r := testRecorder(t, func(cfg *config.Config) {
+		cfg.CaptureRedact = []string{`sk-[a-z0-9]+`, `token=\S+`}
+	})
+	r.Write(&Record{
+		Request:  []byte(`{"messages":[{"role":"user","content":"use sk-abc123 and token=x\"y\\z"}],"n":1}`),
+		Response: []byte(`plain sk-def456`),
+	})
+	require.NoError(t, r.Close())
+
+	files := captureFiles(t, r)
+	require.Len(t, files, 1)
+	line, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	var record Record
+	require.NoError(t, json.Unmarshal(line, &record), "Redaction should keep the record valid JSON")
+	assert.JSONEq(t, `{"messages":[{"role":"user","content":"use [REDACTED] and [REDACTED]"}],"n":1}`, string(record.Request))
+	assert.JSONEq(t, `"plain [REDACTED]"`, string(record.Response), "Bodies that are not JSON should be redacted too")
+}
+
+func TestNewInvalidPattern(t *testing.T) {
+	cfg := config.Default()
+	cfg.CaptureRedact = []string{"("}
+	_, err := New(cfg)
+	assert.ErrorContains(t, err, "invalid capture redact pattern")
+}
+
+func TestRotation(t *testing.T) {
+	r := testRecorder(t, func(cfg *config.Config) {
+		cfg.CaptureMaxFiles = 2
+	})
+	r.maxSize = 200
+	body := []byte(`"` + strings.Repeat("x", 100) + `"`)
+	for range 5 {
+		r.Write(&Record{Request: body})
+	}
+	require.NoError(t, r.Close())
+
+	files := captureFiles(t, r)
+	assert.Len(t, files, 2, "Only the newest files should be kept")
+	for _, file := range files {
+		line, err := os.ReadFile(file)
+		require.NoError(t, err)
+		assert.Equal(t, 1, strings.Count(string(line), "\n"), "Each record should start a new file")
+	}
+}
+
+func TestShouldCapture(t *testing.T) {
+	on, off := true, false
+
+	var nilRecorder *Recorder
+	assert.False(t, nilRecorder.ShouldCapture(&on))
+
+	r := testRecorder(t, nil)
+	assert.True(t, r.ShouldCapture(nil))
+	assert.False(t, r.ShouldCapture(&off), "The model flag should override the global setting")
+
+	r = testRecorder(t, func(cfg *config.Config) { cfg.CaptureEnabled = false })
+	assert.False(t, r.ShouldCapture(nil))
+	assert.True(t, r.ShouldCapture(&on))
+
+	r = testRecorder(t, func(cfg *config.Config) { cfg.CaptureSampleRate = 0 })
+	assert.False(t, r.ShouldCapture(&on), "A zero sample rate should capture nothing")
+
+	r = testRecorder(t, func(cfg *config.Config) { cfg.CaptureSampleRate = 0.5 })
+	captured := 0
+	for range 1000 {
+		if r.ShouldCapture(nil) {
+			captured++
+		}
+	}
+	assert.InDelta(t, 500, captured, 100)
+}
@@ -0,0 +1,148 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+type chunkToolCall struct {
+	Index    int    `json:"index"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type chunk struct {
+	Id      string `json:"id"`
+	Model   string `json:"model"`
+	Created int64  `json:"created"`
+	Choices []struct {
+		Delta struct {
+			Role             string          `json:"role"`
+			Content          string          `json:"content"`
+			ReasoningContent string          `json:"reasoning_content"`
+			Reasoning        string          `json:"reasoning"`
+			ToolCalls        []chunkToolCall `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage json.RawMessage `json:"usage,omitempty"`
+}
+
+// StreamAssembler rebuilds a single chat completion message from the SSE
+// chunks of a streamed response.
+type StreamAssembler struct {
+	id           string
+	model        string
+	created      int64
+	role         string
+	content      strings.Builder
+	reasoning    strings.Builder
+	toolCalls    []*chunkToolCall
+	finishReason *string
+	usage        json.RawMessage
+	raw          [][]byte
+}
+
+// Add consumes the payload of one `data:` line.
+func (a *StreamAssembler) Add(data []byte) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("[DONE]")) {
+		return
+	}
+
+	var c chunk
+	if err := json.Unmarshal(data, &c); err != nil {
+		// Keep what we could not understand, e.g. an error frame.
+		a.raw = append(a.raw, bytes.Clone(data))
+		return
+	}
+
+	if c.Id != "" {
+		a.id = c.Id
+	}
+	if c.Model != "" {
+		a.model = c.Model
+	}
+	if c.Created != 0 {
+		a.created = c.Created
+	}
+	if len(c.Usage) > 0 && !bytes.Equal(c.Usage, []byte("null")) {
+		a.usage = c.Usage
+	}
+
+	for _, choice := range c.Choices {
+		delta := choice.Delta
+		if delta.Role != "" {
+			a.role = delta.Role
+		}
+		a.content.WriteString(delta.Content)
+		a.reasoning.WriteString(delta.ReasoningContent)
+		a.reasoning.WriteString(delta.Reasoning)
+		for _, tc := range delta.ToolCalls {
+			// Indexes come from the upstream; a call may only continue an
+			// earlier one or start the next.
+			if tc.Index < 0 || tc.Index > len(a.toolCalls) {
+				continue
+			}
+			if tc.Index == len(a.toolCalls) {
+				a.toolCalls = append(a.toolCalls, &chunkToolCall{Index: tc.Index})
+			}
+			call := a.toolCalls[tc.Index]
+			if tc.ID != "" {
+				call.ID = tc.ID
+			}
+			if tc.Type != "" {
+				call.Type = tc.Type
+			}
+			call.Function.Name += tc.Function.Name
+			call.Function.Arguments += tc.Function.Arguments
+		}
+		if choice.FinishReason != nil {
+			a.finishReason = choice.FinishReason
+		}
+	}
+}
+
+// Message returns the reassembled response as chat completion JSON.
+func (a *StreamAssembler) Message() json.RawMessage {
+	message := map[string]any{
+		"role":    a.role,
+		"content": a.content.String(),
+	}
+	if a.reasoning.Len() > 0 {
+		message["reasoning_content"] = a.reasoning.String()
+	}
+	if len(a.toolCalls) > 0 {
+		message["tool_calls"] = a.toolCalls
+	}
+
+	completion := map[string]any{
+		"id":      a.id,
+		"object":  "chat.completion",
+		"created": a.created,
+		"model":   a.model,
+		"choices": []map[string]any{{
+			"index":         0,
+			"message":       message,
+			"finish_reason": a.finishReason,
+		}},
+	}
+	if a.usage != nil {
+		completion["usage"] = a.usage
+	}
+	if len(a.raw) > 0 {
+		unparsed := make([]string, len(a.raw))
+		for i, r := range a.raw {
+			unparsed[i] = string(r)
+		}
+		completion["unparsed"] = unparsed
+	}
+
+	b, _ := json.Marshal(completion)
+	return b
+}
@@ -0,0 +1,43 @@
+package capture
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamAssembler(t *testing.T) {
+	var a StreamAssembler
+	for _, data := range []string{
+		`{"id":"c1","model":"gpt-4.1","created":1,"choices":[{"delta":{"role":"assistant","content":"Hel"}}]}`,
+		`{"choices":[{"delta":{"content":"lo","reasoning_content":"hm"}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"ci"}}]}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"ty\":\"Oslo\"}"}}]}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":-1,"function":{"arguments":"x"}},{"index":1000000000,"function":{"arguments":"x"}}]}}]}`,
+		`{"choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+		`{"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}`,
+		`{"error":`,
+		`[DONE]`,
+	} {
+		a.Add([]byte(data))
+	}
+
+	assert.JSONEq(t, `{
+		"id": "c1",
+		"object": "chat.completion",
+		"created": 1,
+		"model": "gpt-4.1",
+		"choices": [{
+			"index": 0,
+			"message": {
+				"role": "assistant",
+				"content": "Hello",
+				"reasoning_content": "hm",
+				"tool_calls": [{"index":0,"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Oslo\"}"}}]
+			},
+			"finish_reason": "tool_calls"
+		}],
+		"usage": {"prompt_tokens":5,"completion_tokens":2,"total_tokens":7},
+		"unparsed": ["{\"error\":"]
+	}`, string(a.Message()), "Out of range tool call indexes should be dropped")
+}
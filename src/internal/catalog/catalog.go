@@ -0,0 +1,168 @@
+// catalog package keeps a cached copy of the upstream model list.
+package catalog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"ollama-api-proxy/src/internal/config"
+	"ollama-api-proxy/src/internal/dto/openai"
+)
+
+// Catalog serves the upstream model list from memory, refreshing it in the
+// background and falling back to the last good list when upstream fails.
+type Catalog struct {
+	config func() *config.Config
+	client *http.Client
+
+	mu      sync.RWMutex
+	models  []openai.Model
+	updated time.Time
+
+	// refreshMu serializes upstream fetches; misses that waited for one
+	// use its result.
+	refreshMu sync.Mutex
+}
+
+// New returns a catalog reading the current configuration through cfg, so
+// it follows configuration reloads.
+func New(cfg func() *config.Config, client *http.Client) *Catalog {
+	return &Catalog{config: cfg, client: client}
+}
+
+// Models returns the cached list when it is fresh, otherwise fetches it. If
+// the fetch fails and a previous list exists, the stale list is returned.
+func (c *Catalog) Models(ctx context.Context) ([]openai.Model, error) {
+	if models, ok := c.cached(); ok {
+		return models, nil
+	}
+
+	c.refreshMu.Lock()
+	// Another caller may have refreshed the list while this one waited.
+	if models, ok := c.cached(); ok {
+		c.refreshMu.Unlock()
+		return models, nil
+	}
+	err := c.refresh(ctx)
+	c.refreshMu.Unlock()
+	if err != nil {
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		if c.models != nil {
+			slog.Warn("Serving stale model list", "error", err, "updated", c.updated)
+			return c.models, nil
+		}
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.models, nil
+}
+
+func (c *Catalog) cached() ([]openai.Model, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ttl := c.config().ModelsTTL
+	if c.models == nil || ttl <= 0 {
+		return nil, false
+	}
+	if time.Since(c.updated) > ttl {
+		return nil, false
+	}
+	return c.models, true
+}
+
+// Refresh fetches the model list from upstream and replaces the cache.
+func (c *Catalog) Refresh(ctx context.Context) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	return c.refresh(ctx)
+}
+
+// refresh is Refresh with refreshMu held.
+func (c *Catalog) refresh(ctx context.Context) error {
+	models, err := c.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.models = models
+	c.updated = time.Now()
+	return nil
+}
+
+// Start refreshes the list every ModelsTTL until ctx is cancelled.
+func (c *Catalog) Start(ctx context.Context) {
+	go func() {
+		for {
+			ttl := c.config().ModelsTTL
+			if ttl > 0 {
+				if err := c.Refresh(ctx); err != nil {
+					slog.Warn("Failed to refresh model list", "error", err)
+				}
+			} else {
+				// Background refresh is disabled; check again later in case
+				// the configuration is reloaded.
+				ttl = time.Minute
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(ttl):
+			}
+		}
+	}()
+}
+
+func (c *Catalog) fetch(ctx context.Context) ([]openai.Model, error) {
+	cfg := c.config()
+	baseUrl, err := url.Parse(cfg.OpenAIBaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+
+	destUrl := baseUrl.JoinPath("models").String()
+	slog.Info("Fetching models from OpenAI API", "url", destUrl)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, destUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cfg.OpenAIAPIKey))
+
+	resp, err := c.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch models: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		return nil, fmt.Errorf("failed to fetch models: %w", openai.ParseError(resp.StatusCode, body))
+	}
+
+	var modelsResponse openai.ListModels
+	if err := json.NewDecoder(resp.Body).Decode(&modelsResponse); err != nil {
+		return nil, fmt.Errorf("failed to decode models response: %w", err)
+	}
+	if modelsResponse.Data == nil {
+		modelsResponse.Data = []openai.Model{}
+	}
+	return modelsResponse.Data, nil
+}
@@ -0,0 +1,48 @@
+package catalog
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ollama-api-proxy/src/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentMisses(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		io.WriteString(w, `{"object":"list","data":[{"id":"gpt-4.1","object":"model","created":1,"owned_by":"openai"}]}`)
+	}))
+	defer server.Close()
+
+	cfg := config.Default()
+	cfg.OpenAIBaseURL = server.URL
+	cfg.ModelsTTL = time.Minute
+	catalog := New(func() *config.Config { return cfg }, server.Client())
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			models, err := catalog.Models(context.Background())
+			assert.NoError(t, err)
+			assert.Len(t, models, 1)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), hits.Load(), "Concurrent misses should share one upstream fetch")
+
+	require.NoError(t, catalog.Refresh(context.Background()))
+	assert.Equal(t, int32(2), hits.Load(), "Refresh should always fetch")
+}
@@ -0,0 +1,98 @@
+package catalog
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"ollama-api-proxy/src/internal/config"
+)
+
+// Filter decides which models are visible to clients. Patterns are globs,
+// or regular expressions when wrapped in slashes (e.g. "/^gpt-4/").
+type Filter struct {
+	include        []func(string) bool
+	exclude        []func(string) bool
+	configuredOnly bool
+}
+
+func NewFilter(cfg *config.Config) (*Filter, error) {
+	include, err := compilePatterns(cfg.ModelsInclude)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compilePatterns(cfg.ModelsExclude)
+	if err != nil {
+		return nil, err
+	}
+	return &Filter{
+		include:        include,
+		exclude:        exclude,
+		configuredOnly: cfg.ModelsConfiguredOnly,
+	}, nil
+}
+
+// Visible reports whether a model may be listed and used.
+func (f *Filter) Visible(name string, models *config.Models) bool {
+	if f == nil {
+		return true
+	}
+	if f.configuredOnly {
+		if models == nil {
+			return false
+		}
+		if _, err := models.GetModel(name); err != nil {
+			return false
+		}
+	}
+	if len(f.include) > 0 && !matchAny(f.include, name) {
+		return false
+	}
+	return !matchAny(f.exclude, name)
+}
+
+// Apply returns the visible entries.
+func (f *Filter) Apply(entries []Entry, models *config.Models) []Entry {
+	visible := entries[:0:0]
+	for _, entry := range entries {
+		if f.Visible(entry.Name, models) {
+			visible = append(visible, entry)
+		}
+	}
+	return visible
+}
+
+func matchAny(matchers []func(string) bool, name string) bool {
+	for _, match := range matchers {
+		if match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func compilePatterns(patterns []string) ([]func(string) bool, error) {
+	matchers := make([]func(string) bool, 0, len(patterns))
+	for _, pattern := range patterns {
+		if pattern == "" {
+			continue
+		}
+		if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid model pattern %q: %w", pattern, err)
+			}
+			matchers = append(matchers, re.MatchString)
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid model pattern %q: %w", pattern, err)
+		}
+		matchers = append(matchers, func(name string) bool {
+			ok, _ := path.Match(pattern, name)
+			return ok
+		})
+	}
+	return matchers, nil
+}
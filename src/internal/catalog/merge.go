@@ -0,0 +1,75 @@
+package catalog
+
+import (
+	"ollama-api-proxy/src/internal/config"
+	"ollama-api-proxy/src/internal/dto/openai"
+)
+
+// Entry is a model of the merged catalogue: the upstream list combined with
+// the configuration from models.yml.
+type Entry struct {
+	Name    string
+	Created int64
+	OwnedBy string
+	// Info is the model configuration, or the default one when the model is
+	// not configured.
+	Info *config.ModelInfo
+	// Missing is set for configured models the upstream did not return.
+	Missing bool
+}
+
+// Merge combines the upstream models with the configured ones. Configured
+// models missing upstream are appended when showMissing is set. Upstream
+// models that resolve to the same configured model are listed once, with
+// the details of the one matching its upstream name.
+func Merge(upstream []openai.Model, models *config.Models, showMissing bool) []Entry {
+	entries := make([]Entry, 0, len(upstream))
+	seen := make(map[string]int, len(upstream))
+
+	for _, m := range upstream {
+		info := lookup(models, m.Id)
+		entry := Entry{
+			Name:    info.Name,
+			Created: m.Created,
+			OwnedBy: m.OwnedBy,
+			Info:    info,
+		}
+		if i, ok := seen[info.Name]; ok {
+			if m.Id == info.GetUpstreamName() {
+				entries[i] = entry
+			}
+			continue
+		}
+		seen[info.Name] = len(entries)
+		entries = append(entries, entry)
+	}
+
+	if showMissing && models != nil {
+		for i := range models.Models {
+			info := &models.Models[i]
+			if _, ok := seen[info.Name]; ok {
+				continue
+			}
+			entries = append(entries, Entry{
+				Name:    info.Name,
+				Info:    info,
+				Missing: true,
+			})
+		}
+	}
+
+	return entries
+}
+
+// lookup returns the configuration of an upstream model, which is listed
+// under its configured name.
+func lookup(models *config.Models, upstreamName string) *config.ModelInfo {
+	if models != nil {
+		if info, err := models.GetModelByUpstream(upstreamName); err == nil {
+			return info
+		}
+	}
+	info := config.DefaultModelInfo()
+	info.Name = upstreamName
+	return info
+}
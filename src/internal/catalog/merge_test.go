@@ -0,0 +1,36 @@
+package catalog
+
+import (
+	"testing"
+
+	"ollama-api-proxy/src/internal/config"
+	"ollama-api-proxy/src/internal/dto/openai"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge(t *testing.T) {
+	models, err := config.LoadModels("merge_test.yml")
+	require.NoError(t, err)
+
+	entries := Merge([]openai.Model{
+		{Id: "gpt-4.1:latest", Created: 1},
+		{Id: "gpt-4.1", Created: 2},
+		{Id: "fast", Created: 3},
+		{Id: "o3", Created: 4},
+		{Id: "claude-sonnet", Created: 5},
+	}, models, true)
+
+	var names []string
+	var created []int64
+	for _, entry := range entries {
+		names = append(names, entry.Name)
+		created = append(created, entry.Created)
+	}
+	assert.Equal(t, []string{"gpt-4.1", "fast", "claude-sonnet", "offline"}, names,
+		"Upstream models resolving to the same configured model should be listed once")
+	assert.Equal(t, []int64{2, 4, 5, 0}, created, "The upstream model of the configured name should win")
+	assert.True(t, entries[3].Missing)
+	assert.False(t, entries[0].Missing)
+}
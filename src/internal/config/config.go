@@ -1,14 +1,23 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
 	"strings"
 	"time"
 
 	"ollama-api-proxy/src/internal/types/model"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/knadh/koanf/parsers/toml/v2"
 	"github.com/knadh/koanf/parsers/yaml"
 	"github.com/knadh/koanf/providers/env"
 	"github.com/knadh/koanf/providers/file"
@@ -20,10 +29,44 @@ type Config struct {
 	Host          string        `koanf:"host" validate:"hostname|ip"`
 	GinMode       string        `koanf:"gin_mode" validate:"oneof=debug release test"`
 	OpenAIBaseURL string        `koanf:"openai_base_url" validate:"url"`
-	OpenAIAPIKey  string        `koanf:"openai_api_key"`
+	OpenAIAPIKey  string        `koanf:"openai_api_key" mask:"true"`
 	LogLevel      string        `koanf:"log_level" validate:"oneof=debug info warn error"`
+	LogFormat     string        `koanf:"log_format" validate:"oneof=text json"`
 	TrustDomains  []string      `koanf:"trust_domains" validate:"dive,hostname|ip"`
-	Timeout       time.Duration `koanf:"timeout" validate:"gte=0"`
+	Timeout       time.Duration `koanf:"timeout" validate:"gte=0"`      // total deadline of an upstream request
+	IdleTimeout   time.Duration `koanf:"idle_timeout" validate:"gte=0"` // max gap between stream chunks
+	ModelsTTL     time.Duration `koanf:"models_ttl" validate:"gte=0"`
+	MissingModels string        `koanf:"missing_models" validate:"oneof=hide show"`
+
+	ModelsInclude        []string `koanf:"models_include"`
+	ModelsExclude        []string `koanf:"models_exclude"`
+	ModelsConfiguredOnly bool     `koanf:"models_configured_only"`
+	ModelsLenient        bool     `koanf:"models_lenient"`
+
+	AdminToken    string `koanf:"admin_token" mask:"true"`
+	TraceExporter string `koanf:"trace_exporter" validate:"oneof=none otlp file"`
+	TraceEndpoint string `koanf:"trace_endpoint" validate:"omitempty,url"`
+	TraceFile     string `koanf:"trace_file" validate:"required_if=TraceExporter file"`
+
+	CaptureEnabled    bool     `koanf:"capture_enabled"` // per model via the models.yml capture flag; API clients carry no key to capture by
+	CaptureDir        string   `koanf:"capture_dir"`
+	CaptureMaxSize    int      `koanf:"capture_max_size" validate:"gte=0"` // in MB, 0 disables rotation
+	CaptureMaxFiles   int      `koanf:"capture_max_files" validate:"gte=0"`
+	CaptureSampleRate float64  `koanf:"capture_sample_rate" validate:"gte=0,lte=1"`
+	CaptureRedact     []string `koanf:"capture_redact"`
+
+	CacheMode    string        `koanf:"cache_mode" validate:"oneof=off memory disk"`
+	CacheSize    int           `koanf:"cache_size" validate:"gte=0"` // max entries of the memory cache
+	CacheDir     string        `koanf:"cache_dir" validate:"required_if=CacheMode disk"`
+	CacheMaxSize int           `koanf:"cache_max_size" validate:"gte=0"` // in MB, max size of the disk cache, 0 for no limit
+	CacheTTL     time.Duration `koanf:"cache_ttl" validate:"gte=0"`
+
+	// Responses kept in memory for /v1/responses previous_response_id.
+	ResponsesStoreSize int           `koanf:"responses_store_size" validate:"gte=0"`
+	ResponsesStoreTTL  time.Duration `koanf:"responses_store_ttl" validate:"gte=0"`
+
+	// TokenizerDir holds tiktoken BPE files such as o200k_base.tiktoken.
+	TokenizerDir string `koanf:"tokenizer_dir"`
 }
 
 func Default() *Config {
@@ -34,23 +77,116 @@ func Default() *Config {
 		OpenAIBaseURL: "https://api.openai.com/v1",
 		OpenAIAPIKey:  "",
 		LogLevel:      "info",
+		LogFormat:     "text",
 		TrustDomains:  []string{"localhost", "127.0.0.1", "::1"},
 		Timeout:       5 * time.Minute, // Default timeout of 5 minutes
+		IdleTimeout:   2 * time.Minute,
+		ModelsTTL:     5 * time.Minute,
+		MissingModels: "hide",
+
+		ModelsInclude:        nil,
+		ModelsExclude:        nil,
+		ModelsConfiguredOnly: false,
+		ModelsLenient:        false,
+
+		AdminToken:    "",
+		TraceExporter: "none",
+		TraceEndpoint: "",
+		TraceFile:     "traces.jsonl",
+
+		CaptureEnabled:    false,
+		CaptureDir:        "captures",
+		CaptureMaxSize:    100,
+		CaptureMaxFiles:   10,
+		CaptureSampleRate: 1,
+		CaptureRedact: []string{
+			`sk-[A-Za-z0-9_\-]{16,}`,
+			`(?i)bearer [A-Za-z0-9._\-]+`,
+		},
+
+		CacheMode:    "off",
+		CacheSize:    1000,
+		CacheDir:     "cache",
+		CacheMaxSize: 1024,
+		CacheTTL:     24 * time.Hour,
+
+		ResponsesStoreSize: 1000,
+		ResponsesStoreTTL:  24 * time.Hour,
+
+		TokenizerDir: "tokenizers",
+	}
+}
+
+// regexListKeys are the list keys holding regular expressions, or globs,
+// which are split by splitPatterns rather than at every comma.
+var regexListKeys = map[string]bool{
+	"capture_redact": true,
+	"models_include": true,
+	"models_exclude": true,
+}
+
+// splitPatterns splits a comma separated list of regular expressions.
+// Commas inside braces, brackets and groups, as in "a{2,5}", and escaped
+// commas do not separate values.
+func splitPatterns(v string) []string {
+	var values []string
+	depth, class, start := 0, false, 0
+	for i := 0; i < len(v); i++ {
+		switch c := v[i]; {
+		case c == '\\':
+			i++
+		case class:
+			class = c != ']'
+		case c == '[':
+			class = true
+		case c == '(' || c == '{':
+			depth++
+		case c == ')' || c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			values = append(values, strings.TrimSpace(v[start:i]))
+			start = i + 1
+		}
 	}
+	return append(values, strings.TrimSpace(v[start:]))
 }
 
-func LoadConfig() (*Config, error) {
+// LoadConfig loads the configuration from the optional config file at path
+// (YAML or TOML, chosen by extension) and layers PROXY_* environment
+// variables on top.
+func LoadConfig(path string) (*Config, error) {
 	config := Default()
 
 	envPrefix := "PROXY_"
-	envSeparator := "_"
 
-	k := koanf.New(envSeparator)
-	if err := k.Load(env.ProviderWithValue(envPrefix, "_", func(k string, v string) (string, any) {
+	// Keys are flat and contain underscores, so "." is used as the delimiter
+	// to keep them intact.
+	k := koanf.New(".")
+
+	if path != "" {
+		parser, err := configParser(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := k.Load(file.Provider(path), parser); err != nil {
+			return nil, fmt.Errorf("error loading config file %s: %w", path, err)
+		}
+		known := koanfKeys(reflect.TypeOf(Config{}))
+		for _, key := range k.Keys() {
+			if !known[key] {
+				return nil, fmt.Errorf("unknown key '%s' in config file %s", key, path)
+			}
+		}
+	}
+
+	if err := k.Load(env.ProviderWithValue(envPrefix, ".", func(k string, v string) (string, any) {
 		key := strings.ToLower(
 			strings.TrimPrefix(k, envPrefix),
 		)
 
+		if regexListKeys[key] {
+			return key, splitPatterns(v)
+		}
 		if strings.Contains(v, ",") {
 			var values []string
 			for val := range strings.SplitSeq(v, ",") {
@@ -81,16 +217,142 @@ func LoadConfig() (*Config, error) {
 	return config, nil
 }
 
+func configParser(path string) (koanf.Parser, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		return yaml.Parser(), nil
+	case ".toml":
+		return toml.Parser(), nil
+	default:
+		return nil, fmt.Errorf("unsupported config file format %q, use .yml, .yaml or .toml", filepath.Ext(path))
+	}
+}
+
+// Masked returns the configuration keyed by its setting names, with secrets
+// masked, for printing.
+func (c *Config) Masked() map[string]any {
+	masked := make(map[string]any)
+	value := reflect.ValueOf(c).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name := tagName(field)
+		if name == "" || name == "-" {
+			continue
+		}
+		switch v := value.Field(i).Interface().(type) {
+		case string:
+			if field.Tag.Get("mask") == "true" && v != "" {
+				masked[name] = "********"
+			} else {
+				masked[name] = v
+			}
+		case time.Duration:
+			masked[name] = v.String()
+		default:
+			masked[name] = v
+		}
+	}
+	return masked
+}
+
 // BaseModel defines the structure for a base model configuration.
 
 type BaseModelConfig struct {
 	Capabilities []model.Capability `koanf:"capabilities,omitempty" validate:"dive,oneof=completion tools vision thinking insert"`
-	InputTokens  int                `koanf:"input_tokens,omitempty"`
-	OutputTokens int                `koanf:"output_tokens,omitempty"`
+	InputTokens  int                `koanf:"input_tokens,omitempty" validate:"gte=0"`
+	OutputTokens int                `koanf:"output_tokens,omitempty" validate:"gte=0"`
+	Capture      *bool              `koanf:"capture,omitempty"`
+
+	// CapabilitiesAdd and CapabilitiesRemove adjust the inherited
+	// capabilities instead of replacing them.
+	CapabilitiesAdd    []model.Capability `koanf:"capabilities_add,omitempty" validate:"dive,oneof=completion tools vision thinking insert"`
+	CapabilitiesRemove []model.Capability `koanf:"capabilities_remove,omitempty" validate:"dive,oneof=completion tools vision thinking insert"`
+
+	Family            string         `koanf:"family,omitempty"`
+	Architecture      string         `koanf:"architecture,omitempty"`
+	ParameterSize     string         `koanf:"parameter_size,omitempty"`
+	QuantizationLevel string         `koanf:"quantization_level,omitempty"`
+	License           string         `koanf:"license,omitempty"`
+	System            string         `koanf:"system,omitempty"`
+	Template          string         `koanf:"template,omitempty"`
+	Parameters        map[string]any `koanf:"parameters,omitempty"`
+
+	// Defaults are request fields applied when the client omits them;
+	// Overrides are always applied. Keys are upstream request JSON fields.
+	Defaults  map[string]any `koanf:"defaults,omitempty"`
+	Overrides map[string]any `koanf:"overrides,omitempty"`
+
+	// Tokenizer is the encoding used to count prompt tokens; by default it
+	// is chosen from the upstream model name.
+	Tokenizer string `koanf:"tokenizer,omitempty" validate:"omitempty,oneof=o200k_base cl100k_base estimate"`
+
+	// Truncation drops messages from prompts over the input limit.
+	Truncation *Truncation `koanf:"truncation,omitempty"`
+
+	// Compat adapts requests to the parameters the upstream model accepts.
+	Compat *Compat `koanf:"compat,omitempty"`
+
+	// ResponsesAPI selects how /v1/responses is served: "translate" to chat
+	// completions (the default) or "passthrough" to the upstream /responses.
+	ResponsesAPI string `koanf:"responses_api,omitempty" validate:"omitempty,oneof=translate passthrough"`
+
+	// CompletionsAPI selects how /v1/completions is served: "emulate" with
+	// chat completions (the default) or "passthrough" to the upstream
+	// /completions.
+	CompletionsAPI string `koanf:"completions_api,omitempty" validate:"omitempty,oneof=emulate passthrough"`
+	// FIMTemplate is the text/template of the chat prompt used to emulate
+	// fill-in-the-middle, with the fields .Prefix and .Suffix.
+	FIMTemplate string `koanf:"fim_template,omitempty" validate:"omitempty,template"`
+
+	// Timeout replaces the global timeout as the total deadline of the
+	// model's upstream requests, e.g. for slow reasoning models.
+	Timeout time.Duration `koanf:"timeout,omitempty" validate:"gte=0"`
+}
+
+// Compat is a parameter compatibility profile, applied to the request after
+// defaults and overrides. Rules are applied in the order rename, drop, clamp.
+type Compat struct {
+	// Profile names a built-in profile the other rules extend.
+	Profile string `koanf:"profile,omitempty" validate:"omitempty,oneof=openai-reasoning"`
+	// Rename moves a field to a new name, unless the new name is already set.
+	Rename map[string]string `koanf:"rename,omitempty"`
+	// Drop removes fields the model rejects.
+	Drop []string `koanf:"drop,omitempty"`
+	// Clamp limits numeric fields to a range. Integer fields such as
+	// max_tokens are rounded into it.
+	Clamp map[string]Range `koanf:"clamp,omitempty"`
+}
+
+// Truncation is an opt-in policy for prompts over the input limit (or the
+// client's Ollama num_ctx, when smaller). System messages and the last
+// message are always kept.
+type Truncation struct {
+	// Strategy picks the messages to drop: "oldest" drops the oldest turns,
+	// "first_last" keeps the first KeepFirst and last KeepLast turns and
+	// drops the oldest in between, "middle_out" drops from the middle.
+	Strategy  string `koanf:"strategy" validate:"oneof=oldest first_last middle_out"`
+	KeepFirst int    `koanf:"keep_first,omitempty" validate:"gte=0"`
+	KeepLast  int    `koanf:"keep_last,omitempty" validate:"gte=0"`
+}
+
+type Range struct {
+	Min *float64 `koanf:"min,omitempty"`
+	Max *float64 `koanf:"max,omitempty"`
+}
+
+// compatProfiles are the built-in compatibility profiles.
+var compatProfiles = map[string]Compat{
+	// OpenAI reasoning models (o1, o3, o4-mini) only accept
+	// max_completion_tokens and reject sampling parameters.
+	"openai-reasoning": {
+		Rename: map[string]string{"max_tokens": "max_completion_tokens"},
+		Drop:   []string{"temperature", "top_p", "presence_penalty", "frequency_penalty", "logprobs", "top_logprobs", "logit_bias"},
+	},
 }
 
 type BaseModel struct {
-	Name            string `koanf:"name"`
+	Name            string  `koanf:"name"`
+	Base            *string `koanf:"base,omitempty"`
 	BaseModelConfig `koanf:"config"`
 }
 
@@ -99,77 +361,374 @@ type ModelInfo struct {
 	Name            string  `koanf:"name"`
 	Base            *string `koanf:"base,omitempty"`
 	BaseModelConfig `koanf:"config"`
-	baseModel       *BaseModel `koanf:"-"`
+	// effective is the config with the whole base chain applied, resolved
+	// once at load time.
+	effective BaseModelConfig `koanf:"-"`
+
+	// Aliases are additional names clients may use for the model.
+	Aliases []string `koanf:"aliases,omitempty"`
+	// UpstreamName is the provider's model ID, when it differs from Name.
+	UpstreamName string `koanf:"upstream_name,omitempty"`
+}
+
+func (m *ModelInfo) GetUpstreamName() string {
+	if m.UpstreamName != "" {
+		return m.UpstreamName
+	}
+	return m.Name
 }
 
 func (m *ModelInfo) GetInputTokens() int {
-	if m.InputTokens != 0 {
-		return m.InputTokens
+	return m.effective.InputTokens
+}
+
+func (m *ModelInfo) GetOutputTokens() int {
+	return m.effective.OutputTokens
+}
+
+func (m *ModelInfo) GetContextLength() int {
+	return m.GetInputTokens() + m.GetOutputTokens()
+}
+
+// GetCapture returns the per-model capture flag, or nil to use the global
+// setting.
+func (m *ModelInfo) GetCapture() *bool {
+	return m.effective.Capture
+}
+
+func (m *ModelInfo) GetFamily() string {
+	return m.effective.Family
+}
+
+func (m *ModelInfo) GetParameterSize() string {
+	return m.effective.ParameterSize
+}
+
+// GetArchitecture returns the declared architecture, falling back to the
+// family and then to "llama".
+func (m *ModelInfo) GetArchitecture() string {
+	if m.effective.Architecture != "" {
+		return m.effective.Architecture
 	}
-	if m.baseModel != nil && m.baseModel.InputTokens != 0 {
-		return m.baseModel.InputTokens
+	if family := m.GetFamily(); family != "" {
+		return family
 	}
-	return 0
+	return "llama"
 }
 
-func (m *ModelInfo) GetOutputTokens() int {
-	if m.OutputTokens != 0 {
-		return m.OutputTokens
+func (m *ModelInfo) GetQuantizationLevel() string {
+	return m.effective.QuantizationLevel
+}
+
+func (m *ModelInfo) GetLicense() string {
+	return m.effective.License
+}
+
+func (m *ModelInfo) GetSystem() string {
+	return m.effective.System
+}
+
+func (m *ModelInfo) GetTemplate() string {
+	return m.effective.Template
+}
+
+// GetParameters returns the inherited parameters overridden by the model's
+// own.
+func (m *ModelInfo) GetParameters() map[string]any {
+	parameters := make(map[string]any)
+	maps.Copy(parameters, m.effective.Parameters)
+	return parameters
+}
+
+// GetDefaults returns the request fields applied when the client omits them.
+// The output token limit is the default for max_tokens unless set otherwise.
+func (m *ModelInfo) GetDefaults() map[string]any {
+	defaults := make(map[string]any)
+	if outputTokens := m.GetOutputTokens(); outputTokens > 0 {
+		defaults["max_tokens"] = outputTokens
 	}
-	if m.baseModel != nil && m.baseModel.OutputTokens != 0 {
-		return m.baseModel.OutputTokens
+	if _, ok := m.effective.Defaults["max_completion_tokens"]; ok {
+		delete(defaults, "max_tokens")
 	}
-	return 0
+	maps.Copy(defaults, m.effective.Defaults)
+	return defaults
 }
 
-func (m *ModelInfo) GetContextLength() int {
-	return m.GetInputTokens() + m.GetOutputTokens()
+// GetOverrides returns the request fields that always replace the client's.
+// A null value removes the field.
+func (m *ModelInfo) GetOverrides() map[string]any {
+	overrides := make(map[string]any)
+	maps.Copy(overrides, m.effective.Overrides)
+	return overrides
 }
 
-func (m *ModelInfo) GetCapabilities() []model.Capability {
-	if m.Capabilities != nil {
-		return m.Capabilities
+func (m *ModelInfo) GetTokenizer() string {
+	return m.effective.Tokenizer
+}
+
+func (m *ModelInfo) GetTruncation() *Truncation {
+	return m.effective.Truncation
+}
+
+// GetResponsesAPI returns how /v1/responses is served for the model.
+func (m *ModelInfo) GetResponsesAPI() string {
+	if m.effective.ResponsesAPI == "" {
+		return "translate"
+	}
+	return m.effective.ResponsesAPI
+}
+
+// GetCompletionsAPI returns how /v1/completions is served for the model.
+func (m *ModelInfo) GetCompletionsAPI() string {
+	if m.effective.CompletionsAPI == "" {
+		return "emulate"
+	}
+	return m.effective.CompletionsAPI
+}
+
+// DefaultFIMTemplate asks a chat model for the text between a prefix and a
+// suffix.
+const DefaultFIMTemplate = `Fill in the missing text between the prefix and the suffix below. Reply with the missing text only, without explanations, quotes or code fences.
+
+<prefix>{{.Prefix}}</prefix>
+<suffix>{{.Suffix}}</suffix>`
+
+func (m *ModelInfo) GetFIMTemplate() string {
+	if m.effective.FIMTemplate == "" {
+		return DefaultFIMTemplate
+	}
+	return m.effective.FIMTemplate
+}
+
+// GetTimeout returns the model's request deadline, or 0 to use the global
+// timeout.
+func (m *ModelInfo) GetTimeout() time.Duration {
+	return m.effective.Timeout
+}
+
+// GetCompat returns the model's compatibility rules with its built-in
+// profile applied, or nil when there are none.
+func (m *ModelInfo) GetCompat() *Compat {
+	compat := m.effective.Compat
+	if compat == nil {
+		return nil
+	}
+	profile, ok := compatProfiles[compat.Profile]
+	if !ok {
+		return compat
+	}
+	merged := &Compat{
+		Profile: compat.Profile,
+		Rename:  maps.Clone(profile.Rename),
+		Drop:    slices.Concat(profile.Drop, compat.Drop),
+		Clamp:   maps.Clone(profile.Clamp),
+	}
+	if merged.Rename == nil {
+		merged.Rename = make(map[string]string)
+	}
+	maps.Copy(merged.Rename, compat.Rename)
+	if merged.Clamp == nil {
+		merged.Clamp = make(map[string]Range)
 	}
-	if m.baseModel != nil && m.baseModel.Capabilities != nil {
-		return m.baseModel.Capabilities
+	maps.Copy(merged.Clamp, compat.Clamp)
+	return merged
+}
+
+// Digest returns a stable synthetic digest derived from the model name and
+// its effective configuration, so it changes whenever the config does.
+func (m *ModelInfo) Digest() string {
+	effective, _ := json.Marshal(struct {
+		Name          string
+		Capabilities  []model.Capability
+		InputTokens   int
+		OutputTokens  int
+		Family        string
+		Architecture  string
+		ParameterSize string
+		Quantization  string
+		Parameters    map[string]any
+	}{
+		Name:          m.Name,
+		Capabilities:  m.GetCapabilities(),
+		InputTokens:   m.GetInputTokens(),
+		OutputTokens:  m.GetOutputTokens(),
+		Family:        m.GetFamily(),
+		Architecture:  m.GetArchitecture(),
+		ParameterSize: m.GetParameterSize(),
+		Quantization:  m.GetQuantizationLevel(),
+		Parameters:    m.GetParameters(),
+	})
+	sum := sha256.Sum256(effective)
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *ModelInfo) GetCapabilities() []model.Capability {
+	if m.effective.Capabilities != nil {
+		return m.effective.Capabilities
 	}
+	return defaultCapabilities()
+}
+
+func defaultCapabilities() []model.Capability {
 	return []model.Capability{"completion", "tools"}
 }
 
+// resolve computes the effective config of every model by applying its base
+// chain from the root down, then the model's own config. Unknown bases and
+// cycles end the chain; they are reported by validation.
+func (m *Models) resolve() {
+	for i := range m.Models {
+		model := &m.Models[i]
+		var chain []*BaseModelConfig
+		seen := make(map[string]bool)
+		for name := model.Base; name != nil && !seen[*name]; {
+			seen[*name] = true
+			idx, exists := m.mapBases[*name]
+			if !exists {
+				break
+			}
+			chain = append(chain, &m.Bases[idx].BaseModelConfig)
+			name = m.Bases[idx].Base
+		}
+
+		var effective BaseModelConfig
+		for j := len(chain) - 1; j >= 0; j-- {
+			effective.overlay(chain[j])
+		}
+		effective.overlay(&model.BaseModelConfig)
+		model.effective = effective
+	}
+}
+
+// overlay applies the non-zero fields of src on top of c. Maps are merged
+// key by key; every other field is replaced. Capability additions and
+// removals are applied to the capabilities inherited so far. Zero values
+// mean unset, so src cannot reset an inherited field to zero or empty;
+// pointer fields such as Capture are the exception, a non-nil false wins.
+func (c *BaseModelConfig) overlay(src *BaseModelConfig) {
+	dst := reflect.ValueOf(c).Elem()
+	from := reflect.ValueOf(src).Elem()
+	for i := 0; i < from.NumField(); i++ {
+		field := from.Field(i)
+		if field.IsZero() {
+			continue
+		}
+		switch name := from.Type().Field(i).Name; {
+		case name == "CapabilitiesAdd" || name == "CapabilitiesRemove":
+			continue
+		case field.Kind() == reflect.Map:
+			if dst.Field(i).IsNil() {
+				dst.Field(i).Set(reflect.MakeMap(field.Type()))
+			}
+			iter := field.MapRange()
+			for iter.Next() {
+				dst.Field(i).SetMapIndex(iter.Key(), iter.Value())
+			}
+		default:
+			dst.Field(i).Set(field)
+		}
+	}
+
+	if len(src.CapabilitiesAdd) == 0 && len(src.CapabilitiesRemove) == 0 {
+		return
+	}
+	capabilities := c.Capabilities
+	if capabilities == nil {
+		capabilities = defaultCapabilities()
+	}
+	capabilities = slices.Clone(capabilities)
+	for _, capability := range src.CapabilitiesAdd {
+		if !slices.Contains(capabilities, capability) {
+			capabilities = append(capabilities, capability)
+		}
+	}
+	c.Capabilities = slices.DeleteFunc(capabilities, func(capability model.Capability) bool {
+		return slices.Contains(src.CapabilitiesRemove, capability)
+	})
+}
+
 // Models holds the configuration for all bases and models.
 type Models struct {
-	Bases     []BaseModel    `koanf:"bases"`
-	Models    []ModelInfo    `koanf:"models"`
-	mapBases  map[string]int `koanf:"-"`
-	mapModels map[string]int `koanf:"-"`
+	Bases       []BaseModel    `koanf:"bases"`
+	Models      []ModelInfo    `koanf:"models"`
+	mapBases    map[string]int `koanf:"-"`
+	mapModels   map[string]int `koanf:"-"`
+	mapUpstream map[string]int `koanf:"-"`
+}
+
+// NormalizeName strips the default Ollama host, namespace and tag from a
+// model name, so "registry.ollama.ai/library/o3:latest" becomes "o3".
+func NormalizeName(name string) string {
+	n := model.ParseName(name)
+	if n.Model == "" {
+		return name
+	}
+	short := n.DisplayShortest()
+	if strings.EqualFold(n.Tag, model.DefaultName().Tag) {
+		short = short[:strings.LastIndex(short, ":")]
+	}
+	return short
 }
 
 func DefaultModelInfo() *ModelInfo {
-	return &ModelInfo{
+	info := &ModelInfo{
 		Name: "default",
 		BaseModelConfig: BaseModelConfig{
 			Capabilities: []model.Capability{"completion", "tools"},
 			InputTokens:  0,
 			OutputTokens: 0,
 		},
-		Base:      nil,
-		baseModel: nil,
+		Base: nil,
 	}
+	info.effective.overlay(&info.BaseModelConfig)
+	return info
 }
 
+// GetModel looks up a model by name or alias. Names are compared after
+// [NormalizeName], so Ollama-style names match their configuration.
 func (m *Models) GetModel(name string) (*ModelInfo, error) {
 	if idx, exists := m.mapModels[name]; exists {
 		return &m.Models[idx], nil
 	}
+	if idx, exists := m.mapModels[NormalizeName(name)]; exists {
+		return &m.Models[idx], nil
+	}
 	return nil, fmt.Errorf("model '%s' not found", name)
 }
 
+// GetModelByUpstream looks up a model by the provider's model ID.
+func (m *Models) GetModelByUpstream(upstreamName string) (*ModelInfo, error) {
+	if idx, exists := m.mapUpstream[upstreamName]; exists {
+		return &m.Models[idx], nil
+	}
+	return m.GetModel(upstreamName)
+}
+
+// bytesProvider is a koanf provider for a file that was already read.
+type bytesProvider []byte
+
+func (b bytesProvider) ReadBytes() ([]byte, error) {
+	return b, nil
+}
+
+func (b bytesProvider) Read() (map[string]any, error) {
+	return nil, errors.New("bytesProvider does not support Read")
+}
+
+// LoadModels reads and validates the models file. When the file parses but
+// fails validation, the best-effort models are returned together with a
+// *ModelsError describing every problem.
 func LoadModels(path string) (*Models, error) {
 	var models Models
 	k := koanf.New("_")
 
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error loading models.yml: %w", err)
+	}
+
 	// Load models.yml file
-	if err := k.Load(file.Provider(path), yaml.Parser()); err != nil {
+	if err := k.Load(bytesProvider(data), yaml.Parser()); err != nil {
 		return nil, fmt.Errorf("error loading models.yml: %w", err)
 	}
 
@@ -184,16 +743,26 @@ func LoadModels(path string) (*Models, error) {
 	}
 
 	models.mapModels = make(map[string]int)
+	models.mapUpstream = make(map[string]int)
 	for i := range models.Models {
 		model := &models.Models[i]
 		models.mapModels[model.Name] = i
-		if model.Base != nil {
-			if baseIdx, exists := models.mapBases[*model.Base]; exists {
-				model.baseModel = &models.Bases[baseIdx]
-			} else {
-				slog.Warn("Model references non-existent base", "model", model.Name, "base", *model.Base)
+		if _, exists := models.mapModels[NormalizeName(model.Name)]; !exists {
+			models.mapModels[NormalizeName(model.Name)] = i
+		}
+		for _, alias := range model.Aliases {
+			alias = NormalizeName(alias)
+			if _, exists := models.mapModels[alias]; !exists {
+				models.mapModels[alias] = i
 			}
 		}
+		models.mapUpstream[model.GetUpstreamName()] = i
+	}
+
+	models.resolve()
+
+	if issues := validateModels(data, &models); len(issues) > 0 {
+		return &models, &ModelsError{Path: path, Issues: issues}
 	}
 
 	return &models, nil
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 
 	"ollama-api-proxy/src/internal/types/model"
 
@@ -18,7 +19,7 @@ func TestLoadConfig(t *testing.T) {
 	os.Setenv("PROXY_TRUST_DOMAINS", "example.com,localhost")
 	os.Setenv("PROXY_TIMEOUT", "30s")
 
-	config, err := LoadConfig()
+	config, err := LoadConfig("")
 	assert.NoError(t, err)
 	assert.NotNil(t, config)
 	assert.Equal(t, 8080, config.Port)
@@ -31,6 +32,20 @@ func TestLoadConfig(t *testing.T) {
 	assert.Equal(t, 30, int(config.Timeout.Seconds()), "Timeout should be 30 seconds")
 }
 
+func TestLoadConfigPatterns(t *testing.T) {
+	t.Setenv("PROXY_CAPTURE_REDACT", `sk-[A-Za-z0-9,]{16,}, (?i)token=(\w+,)?\w{8,32},a\,b`)
+
+	config, err := LoadConfig("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`sk-[A-Za-z0-9,]{16,}`, `(?i)token=(\w+,)?\w{8,32}`, `a\,b`}, config.CaptureRedact,
+		"Commas inside a regex should not split it")
+
+	t.Setenv("PROXY_MODELS_INCLUDE", "gpt-4*,/^o[0-9]{1,2}-/")
+	config, err = LoadConfig("")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"gpt-4*", "/^o[0-9]{1,2}-/"}, config.ModelsInclude)
+}
+
 func TestModelsConfig(t *testing.T) {
 	models, err := LoadModels("config_test.yml")
 	assert.NotNil(t, models)
@@ -40,7 +55,6 @@ func TestModelsConfig(t *testing.T) {
 	model1, err := models.GetModel("gpt-4.1")
 	assert.NotNil(t, model1, "gpt-4.1 model should be loaded")
 	assert.Equal(t, "gpt-4.1", model1.Name, "Model name should be gpt-4.1")
-	assert.NotNil(t, model1.baseModel, "Base model should not be nil")
 
 	model2, err := models.GetModel("gpt-4.1-mini")
 	assert.NotNil(t, model2, "gpt-4.1-mini model should be loaded")
@@ -50,3 +64,94 @@ func TestModelsConfig(t *testing.T) {
 	assert.NoError(t, err, "Should not error when getting capabilities")
 	assert.Equal(t, capabilities, []model.Capability{"completion", "tools"}, "Capabilities should match")
 }
+
+func TestNormalizeName(t *testing.T) {
+	assert.Equal(t, "gpt-4.1", NormalizeName("gpt-4.1:latest"))
+	assert.Equal(t, "o3", NormalizeName("library/o3"))
+	assert.Equal(t, "o3", NormalizeName("registry.ollama.ai/library/o3:latest"))
+	assert.Equal(t, "qwen3:free", NormalizeName("qwen3:free"))
+	assert.Equal(t, "openai/gpt-4.1", NormalizeName("openai/gpt-4.1"))
+
+	models, err := LoadModels("config_test.yml")
+	assert.NoError(t, err)
+	model, err := models.GetModel("gpt-4.1-mini:latest")
+	assert.NoError(t, err)
+	assert.Equal(t, "gpt-4.1-mini", model.Name, "Tagged name should match the configured model")
+}
+
+func TestModelsValidation(t *testing.T) {
+	models, err := LoadModels("config_invalid_test.yml")
+	assert.NotNil(t, models, "Invalid models should still be returned on a best-effort basis")
+
+	var modelsErr *ModelsError
+	assert.ErrorAs(t, err, &modelsErr)
+	assert.Equal(t, "config_invalid_test.yml", modelsErr.Path)
+
+	msg := err.Error()
+	assert.Contains(t, msg, "config_invalid_test.yml:7: unknown key 'max_tokens' in bases[0].config")
+	assert.Contains(t, msg, "config_invalid_test.yml:6: bases[0].config.capabilities[1]")
+	assert.Contains(t, msg, "config_invalid_test.yml:19: models[0].config.output_tokens")
+	assert.Contains(t, msg, "config_invalid_test.yml:17: model 'gpt-4.1' references unknown base 'missing'")
+	assert.Contains(t, msg, "config_invalid_test.yml:21: duplicate model 'gpt-4.1'")
+	assert.Contains(t, msg, "config_invalid_test.yml:10: base 'loop-a' inherits from itself: loop-a -> loop-b -> loop-a")
+	assert.Contains(t, msg, "config_invalid_test.yml:25: models[1].config.compat.profile: value 'unknown' does not satisfy 'oneof openai-reasoning'")
+	assert.Contains(t, msg, "config_invalid_test.yml:26: unknown key 'strip' in models[1].config.compat")
+	assert.Contains(t, msg, "config_invalid_test.yml:34: models[3].config.truncation.strategy: value 'newest' does not satisfy 'oneof oldest first_last middle_out'")
+	assert.Contains(t, msg, "config_invalid_test.yml:35: models[3].config.fim_template: value '{{.Prefix' does not satisfy 'template'")
+
+	o3, err := models.GetModel("o3")
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Capability{"completion", "tools"}, o3.GetCapabilities(), "A cyclic chain should still resolve")
+}
+
+func TestModelsAliases(t *testing.T) {
+	_, err := LoadModels("config_alias_test.yml")
+	var modelsErr *ModelsError
+	assert.ErrorAs(t, err, &modelsErr)
+	assert.Len(t, modelsErr.Issues, 1, "An alias of the model's own name should not collide")
+	assert.Contains(t, err.Error(), "config_alias_test.yml:6: alias 'reasoner' of model 'o4-mini' is already used by model 'o3'")
+}
+
+func TestModelsInheritance(t *testing.T) {
+	models, err := LoadModels("config_inherit_test.yml")
+	assert.NoError(t, err)
+
+	o3, err := models.GetModel("o3")
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Capability{"completion", "thinking", "vision"}, o3.GetCapabilities())
+	assert.Equal(t, 8192, o3.GetInputTokens(), "Input tokens should come from the root base")
+	assert.Equal(t, 32768, o3.GetOutputTokens(), "Output tokens should come from the intermediate base")
+	assert.Equal(t, "o", o3.GetArchitecture())
+	assert.Equal(t, 30*time.Minute, o3.GetTimeout(), "Timeout should come from the intermediate base")
+	assert.Equal(t, map[string]any{"temperature": 1, "top_p": 0.9}, o3.GetParameters())
+	assert.Equal(t, map[string]any{"reasoning_effort": "medium", "max_completion_tokens": 16384}, o3.GetDefaults(),
+		"An explicit max_completion_tokens default should replace the implicit max_tokens")
+	assert.Equal(t, map[string]any{"temperature": nil}, o3.GetOverrides())
+
+	compat := o3.GetCompat()
+	assert.Equal(t, "max_completion_tokens", compat.Rename["max_tokens"], "Rules should extend the built-in profile")
+	assert.Contains(t, compat.Drop, "temperature")
+	assert.Contains(t, compat.Drop, "seed")
+	assert.Equal(t, 100000.0, *compat.Clamp["max_completion_tokens"].Max)
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	for _, key := range []string{"PROXY_PORT", "PROXY_OPENAI_API_KEY", "PROXY_TRUST_DOMAINS"} {
+		os.Unsetenv(key)
+	}
+	t.Setenv("PROXY_HOST", "env.example.com")
+
+	config, err := LoadConfig("config_file_test.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, 9090, config.Port, "Port should come from the config file")
+	assert.Equal(t, "env.example.com", config.Host, "Environment should override the config file")
+	assert.Equal(t, []string{"example.com", "localhost"}, config.TrustDomains)
+	assert.Equal(t, 10*time.Minute, config.ModelsTTL)
+
+	masked := config.Masked()
+	assert.Equal(t, "********", masked["openai_api_key"], "Secrets should be masked")
+	assert.Equal(t, "10m0s", masked["models_ttl"])
+
+	_, err = LoadConfig("config_test.yml")
+	assert.ErrorContains(t, err, "unknown key 'bases'")
+}
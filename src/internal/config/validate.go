@@ -0,0 +1,342 @@
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/go-playground/validator/v10"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// ModelsIssue is a single problem found in a models file.
+type ModelsIssue struct {
+	Line    int
+	Message string
+}
+
+// ModelsError lists every problem found in a models file.
+type ModelsError struct {
+	Path   string
+	Issues []ModelsIssue
+}
+
+func (e *ModelsError) Error() string {
+	lines := make([]string, len(e.Issues))
+	for i, issue := range e.Issues {
+		lines[i] = fmt.Sprintf("%s:%d: %s", e.Path, issue.Line, issue.Message)
+	}
+	return fmt.Sprintf("invalid models file %s:\n - %s", e.Path, strings.Join(lines, "\n - "))
+}
+
+type modelsValidator struct {
+	issues   []ModelsIssue
+	validate *validator.Validate
+}
+
+func (v *modelsValidator) addf(node *yamlv3.Node, format string, args ...any) {
+	line := 0
+	if node != nil {
+		line = node.Line
+	}
+	v.issues = append(v.issues, ModelsIssue{Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+// validateModels checks the raw document for unknown keys and the decoded
+// models for semantic errors, reporting the line of each problem.
+func validateModels(data []byte, models *Models) []ModelsIssue {
+	v := &modelsValidator{validate: validator.New()}
+	v.validate.RegisterValidation("template", isTemplate)
+
+	var root yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &root); err != nil {
+		v.addf(nil, "%v", err)
+		return v.issues
+	}
+	if len(root.Content) == 0 {
+		return nil
+	}
+	doc := root.Content[0]
+	if doc.Kind != yamlv3.MappingNode {
+		v.addf(doc, "expected a mapping with 'bases' and 'models'")
+		return v.issues
+	}
+
+	v.checkKeys(doc, reflect.TypeOf(Models{}), "")
+	baseNodes := v.sequence(doc, "bases")
+	modelNodes := v.sequence(doc, "models")
+
+	for i := range models.Bases {
+		node := nodeAt(baseNodes, i)
+		path := fmt.Sprintf("bases[%d]", i)
+		v.checkKeys(node, reflect.TypeOf(BaseModel{}), path)
+		v.checkConfigKeys(mappingValue(node, "config"), path+".config")
+		v.checkStruct(node, path, &models.Bases[i])
+	}
+
+	for i := range models.Models {
+		node := nodeAt(modelNodes, i)
+		path := fmt.Sprintf("models[%d]", i)
+		v.checkKeys(node, reflect.TypeOf(ModelInfo{}), path)
+		v.checkConfigKeys(mappingValue(node, "config"), path+".config")
+		v.checkStruct(node, path, &models.Models[i])
+	}
+
+	v.checkNames(models, baseNodes, modelNodes)
+	return v.issues
+}
+
+// checkKeys reports keys of a mapping that have no koanf field in t.
+func (v *modelsValidator) checkKeys(node *yamlv3.Node, t reflect.Type, path string) {
+	if node == nil {
+		return
+	}
+	if node.Kind != yamlv3.MappingNode {
+		v.addf(node, "%s: expected a mapping", strings.TrimPrefix(path, "."))
+		return
+	}
+	known := koanfKeys(t)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		if !known[key.Value] {
+			if path == "" {
+				v.addf(key, "unknown key '%s'", key.Value)
+			} else {
+				v.addf(key, "unknown key '%s' in %s", key.Value, path)
+			}
+		}
+	}
+}
+
+// checkConfigKeys reports unknown keys in a config block and its nested
+// sections.
+func (v *modelsValidator) checkConfigKeys(config *yamlv3.Node, path string) {
+	v.checkKeys(config, reflect.TypeOf(BaseModelConfig{}), path)
+	v.checkKeys(mappingValue(config, "truncation"), reflect.TypeOf(Truncation{}), path+".truncation")
+	compat := mappingValue(config, "compat")
+	v.checkKeys(compat, reflect.TypeOf(Compat{}), path+".compat")
+	clamp := mappingValue(compat, "clamp")
+	if clamp != nil && clamp.Kind == yamlv3.MappingNode {
+		for i := 0; i+1 < len(clamp.Content); i += 2 {
+			v.checkKeys(clamp.Content[i+1], reflect.TypeOf(Range{}), path+".compat.clamp."+clamp.Content[i].Value)
+		}
+	}
+}
+
+// checkStruct runs the validate tags of a base or model.
+func (v *modelsValidator) checkStruct(node *yamlv3.Node, path string, s any) {
+	err := v.validate.Struct(s)
+	if err == nil {
+		return
+	}
+	errs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		v.addf(node, "%s: %v", path, err)
+		return
+	}
+	for _, fe := range errs {
+		key, target := locateField(node, reflect.TypeOf(s).Elem(), fe.Namespace())
+		v.addf(target, "%s.%s: value '%v' does not satisfy '%s%s'",
+			path, key, fe.Value(), fe.Tag(), prefixed(" ", fe.Param()))
+	}
+}
+
+// isTemplate reports whether a field holds a valid text/template.
+func isTemplate(fl validator.FieldLevel) bool {
+	_, err := template.New("").Parse(fl.Field().String())
+	return err == nil
+}
+
+// locateField maps a validator namespace such as
+// "ModelInfo.BaseModelConfig.Capabilities[1]" to its koanf key path and the
+// closest YAML node.
+func locateField(node *yamlv3.Node, t reflect.Type, namespace string) (string, *yamlv3.Node) {
+	var keys []string
+	target := node
+	parts := strings.Split(namespace, ".")
+	for _, part := range parts[1:] {
+		// Errors inside lists are reported as "Field[i]".
+		name, index, _ := strings.Cut(part, "[")
+		field, ok := t.FieldByName(name)
+		if !ok {
+			keys = append(keys, part)
+			break
+		}
+		key := cmp.Or(tagName(field), name)
+		next := mappingValue(target, key)
+		if index != "" {
+			key += "[" + index
+			var i int
+			if _, err := fmt.Sscanf(index, "%d]", &i); err == nil {
+				if item := nodeAt(sequenceItems(next), i); item != nil {
+					next = item
+				}
+			}
+		}
+		keys = append(keys, key)
+		if next != nil {
+			target = next
+		}
+
+		t = field.Type
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			break
+		}
+	}
+	if target == nil {
+		target = node
+	}
+	return strings.Join(keys, "."), target
+}
+
+// checkNames reports missing and duplicate names, name collisions between
+// models and aliases, references to unknown bases and inheritance cycles.
+func (v *modelsValidator) checkNames(models *Models, baseNodes, modelNodes []*yamlv3.Node) {
+	bases := make(map[string]bool)
+	for i, base := range models.Bases {
+		node := nodeAt(baseNodes, i)
+		switch {
+		case base.Name == "":
+			v.addf(node, "bases[%d]: missing name", i)
+		case bases[base.Name]:
+			v.addf(mappingValue(node, "name"), "duplicate base '%s'", base.Name)
+		}
+		bases[base.Name] = true
+	}
+
+	for i, base := range models.Bases {
+		if base.Base == nil {
+			continue
+		}
+		node := mappingValue(nodeAt(baseNodes, i), "base")
+		if !bases[*base.Base] {
+			v.addf(node, "base '%s' references unknown base '%s'", base.Name, *base.Base)
+		} else if cycle := baseCycle(models, base.Name); cycle != nil {
+			v.addf(node, "base '%s' inherits from itself: %s", base.Name, strings.Join(cycle, " -> "))
+		}
+	}
+
+	names := make(map[string]string)
+	for i := range models.Models {
+		model := &models.Models[i]
+		node := nodeAt(modelNodes, i)
+		if model.Name == "" {
+			v.addf(node, "models[%d]: missing name", i)
+			continue
+		}
+
+		for _, name := range append([]string{model.Name}, model.Aliases...) {
+			normalized := NormalizeName(name)
+			if owner, exists := names[normalized]; exists {
+				if name != model.Name && owner == model.Name {
+					// An alias that only restates the model's own name.
+					continue
+				}
+				if name == model.Name {
+					v.addf(mappingValue(node, "name"), "duplicate model '%s' (already defined as '%s')", name, owner)
+				} else {
+					v.addf(mappingValue(node, "aliases"), "alias '%s' of model '%s' is already used by model '%s'", name, model.Name, owner)
+				}
+				continue
+			}
+			names[normalized] = model.Name
+		}
+
+		if model.Base != nil && !bases[*model.Base] {
+			v.addf(mappingValue(node, "base"), "model '%s' references unknown base '%s'", model.Name, *model.Base)
+		}
+	}
+}
+
+// baseCycle returns the inheritance chain from name back to itself, or nil
+// when the chain of name ends without a cycle.
+func baseCycle(models *Models, name string) []string {
+	chain := []string{name}
+	seen := map[string]bool{name: true}
+	for current := name; ; {
+		idx, exists := models.mapBases[current]
+		if !exists || models.Bases[idx].Base == nil {
+			return nil
+		}
+		current = *models.Bases[idx].Base
+		chain = append(chain, current)
+		if current == name {
+			return chain
+		}
+		if seen[current] {
+			// The cycle does not include name; it is reported for its members.
+			return nil
+		}
+		seen[current] = true
+	}
+}
+
+func (v *modelsValidator) sequence(doc *yamlv3.Node, key string) []*yamlv3.Node {
+	node := mappingValue(doc, key)
+	if node == nil {
+		return nil
+	}
+	if node.Kind != yamlv3.SequenceNode {
+		v.addf(node, "'%s' must be a list", key)
+		return nil
+	}
+	return node.Content
+}
+
+func sequenceItems(node *yamlv3.Node) []*yamlv3.Node {
+	if node == nil || node.Kind != yamlv3.SequenceNode {
+		return nil
+	}
+	return node.Content
+}
+
+func nodeAt(nodes []*yamlv3.Node, i int) *yamlv3.Node {
+	if i < len(nodes) {
+		return nodes[i]
+	}
+	return nil
+}
+
+func mappingValue(node *yamlv3.Node, key string) *yamlv3.Node {
+	if node == nil || node.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// koanfKeys returns the koanf keys of the exported fields of t.
+func koanfKeys(t reflect.Type) map[string]bool {
+	keys := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if name := tagName(field); name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	return keys
+}
+
+func tagName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("koanf"), ",")
+	return name
+}
+
+func prefixed(prefix, s string) string {
+	if s == "" {
+		return ""
+	}
+	return prefix + s
+}
@@ -4,3 +4,7 @@ const (
 	// Version is the current version of the application
 	OllamaAPIVersion = "0.6.8"
 )
+
+// Version is the proxy version, set at build time with
+// -ldflags "-X ollama-api-proxy/src/internal/constants.Version=<version>".
+var Version = "dev"
@@ -0,0 +1,27 @@
+// conversation package keeps the messages of stored /v1/responses responses
+// so later requests can continue them with previous_response_id.
+package conversation
+
+import (
+	"time"
+
+	"ollama-api-proxy/src/internal/dto/newapi"
+	"ollama-api-proxy/src/internal/lru"
+)
+
+// Conversation is the chat history up to and including a response.
+// Instructions are not part of it, they only apply to the request that set
+// them.
+type Conversation struct {
+	Messages []newapi.Message
+	Created  time.Time
+}
+
+// Store is an in-memory LRU of conversations keyed by response ID.
+type Store = lru.Cache[*Conversation]
+
+// NewStore returns a store holding up to size conversations for ttl. Zero
+// disables the respective limit.
+func NewStore(size int, ttl time.Duration) *Store {
+	return lru.New[*Conversation](size, ttl)
+}
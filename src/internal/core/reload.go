@@ -0,0 +1,166 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"ollama-api-proxy/src/internal/catalog"
+	"ollama-api-proxy/src/internal/config"
+	"ollama-api-proxy/src/internal/state"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Settings only applied at startup. A reload that changes them logs a
+// warning and keeps running with the old values. timeout and idle_timeout
+// are read per request, so they apply to requests started after a reload.
+var restartKeys = []string{"port", "host", "gin_mode", "trust_domains", "admin_token", "log_format"}
+var restartPrefixes = []string{"trace_", "capture_", "cache_", "tokenizer_", "responses_store_"}
+
+// Reloader re-reads the proxy configuration and models.yml when any of the files
+// changes or the process receives SIGHUP, and swaps them into the state.
+// Invalid files are logged and the previous configuration is kept.
+type Reloader struct {
+	State      *state.State
+	ModelsPath string
+	// ConfigPaths are the files LoadConfig reads, such as .env and the
+	// config file.
+	ConfigPaths []string
+	LoadConfig  func() (*config.Config, error)
+	// OnConfig is called after a new configuration has been applied.
+	OnConfig func(*config.Config)
+}
+
+// Reload loads both files and applies whichever is valid.
+func (r *Reloader) Reload() {
+	models, err := config.LoadModels(r.ModelsPath)
+	var modelsErr *config.ModelsError
+	if err != nil && (!r.State.Config().ModelsLenient || !errors.As(err, &modelsErr)) {
+		slog.Error("Failed to reload models, keeping previous configuration", "path", r.ModelsPath, "error", err)
+	} else {
+		if err != nil {
+			slog.Warn("Models file has errors, applying because models_lenient is set", "path", r.ModelsPath, "error", err)
+		}
+		r.State.SetModels(models)
+		slog.Info("Models reloaded", "path", r.ModelsPath, "models", len(models.Models))
+	}
+
+	if r.LoadConfig == nil {
+		return
+	}
+	cfg, err := r.LoadConfig()
+	if err != nil {
+		slog.Error("Failed to reload configuration, keeping previous configuration", "error", err)
+		return
+	}
+	visibility, err := catalog.NewFilter(cfg)
+	if err != nil {
+		slog.Error("Failed to reload configuration, keeping previous configuration", "error", err)
+		return
+	}
+
+	old := r.State.Config()
+	if changed := restartRequired(old, cfg); len(changed) > 0 {
+		slog.Warn("Some settings only take effect after a restart", "settings", changed)
+	}
+	r.State.SetVisibility(visibility)
+	r.State.SetConfig(cfg)
+	if r.OnConfig != nil {
+		r.OnConfig(cfg)
+	}
+	slog.Info("Configuration reloaded")
+}
+
+// Watch reloads on file changes and SIGHUP until ctx is cancelled.
+func (r *Reloader) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// Watch the directories, since editors and config maps replace files
+	// rather than writing them in place.
+	watched := make(map[string]bool)
+	for _, path := range append([]string{r.ModelsPath}, r.ConfigPaths...) {
+		if path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		watched[abs] = true
+		if err := watcher.Add(filepath.Dir(abs)); err != nil {
+			return err
+		}
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	// Editors often emit several events per save; wait for them to settle.
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hangup:
+			slog.Info("Received SIGHUP, reloading configuration")
+			r.Reload()
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if abs, _ := filepath.Abs(event.Name); watched[abs] && !event.Has(fsnotify.Chmod) {
+				debounce = time.After(250 * time.Millisecond)
+			}
+		case <-debounce:
+			debounce = nil
+			r.Reload()
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Warn("Configuration watcher error", "error", err)
+		}
+	}
+}
+
+func restartRequired(old, new *config.Config) []string {
+	var changed []string
+	oldValue := reflect.ValueOf(old).Elem()
+	newValue := reflect.ValueOf(new).Elem()
+	for i, field := range reflect.VisibleFields(oldValue.Type()) {
+		key := field.Tag.Get("koanf")
+		if !isRestartKey(key) {
+			continue
+		}
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), newValue.Field(i).Interface()) {
+			changed = append(changed, key)
+		}
+	}
+	return changed
+}
+
+func isRestartKey(key string) bool {
+	if slices.Contains(restartKeys, key) {
+		return true
+	}
+	for _, prefix := range restartPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,77 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ollama-api-proxy/src/internal/config"
+	"ollama-api-proxy/src/internal/state"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testModels = `
+models:
+  - name: "gpt-4.1"
+`
+
+// testReloader returns a reloader for a models file holding yml, whose
+// configuration is loaded by load.
+func testReloader(t *testing.T, yml string, load func() (*config.Config, error)) *Reloader {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "models.yml")
+	require.NoError(t, os.WriteFile(path, []byte(yml), 0o644))
+	appState := &state.State{}
+	appState.SetConfig(config.Default())
+	return &Reloader{State: appState, ModelsPath: path, LoadConfig: load}
+}
+
+func TestReload(t *testing.T) {
+	cfg := config.Default()
+	cfg.Timeout = time.Minute
+	var applied *config.Config
+	r := testReloader(t, testModels, func() (*config.Config, error) { return cfg, nil })
+	r.OnConfig = func(cfg *config.Config) { applied = cfg }
+
+	r.Reload()
+	require.NotNil(t, r.State.Models())
+	_, err := r.State.Models().GetModel("gpt-4.1")
+	assert.NoError(t, err, "The new models should be applied")
+	assert.Same(t, cfg, r.State.Config(), "The new configuration should be applied")
+	assert.Same(t, cfg, applied)
+	assert.NotNil(t, r.State.Visibility())
+}
+
+func TestReloadInvalid(t *testing.T) {
+	r := testReloader(t, testModels, func() (*config.Config, error) { return nil, errors.New("invalid port") })
+	r.Reload()
+	models, cfg := r.State.Models(), r.State.Config()
+	require.NotNil(t, models)
+
+	require.NoError(t, os.WriteFile(r.ModelsPath, []byte("models:\n  - name: \"gpt-4.1\"\n    config:\n      input_tokens: -1\n"), 0o644))
+	r.Reload()
+	assert.Same(t, models, r.State.Models(), "Invalid models should keep the previous ones")
+	assert.Same(t, cfg, r.State.Config(), "An invalid configuration should keep the previous one")
+
+	invalid := config.Default()
+	invalid.ModelsInclude = []string{"/(/"}
+	r.LoadConfig = func() (*config.Config, error) { return invalid, nil }
+	r.Reload()
+	assert.Same(t, cfg, r.State.Config(), "A configuration with invalid model filters should not be applied")
+}
+
+func TestRestartRequired(t *testing.T) {
+	old := config.Default()
+	changed := config.Default()
+	changed.Port = old.Port + 1
+	changed.CaptureDir = "elsewhere"
+	changed.Timeout = time.Hour
+	changed.LogLevel = "debug"
+	assert.Equal(t, []string{"port", "capture_dir"}, restartRequired(old, changed),
+		"Only settings read at startup should need a restart")
+	assert.Empty(t, restartRequired(old, config.Default()))
+}
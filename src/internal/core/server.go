@@ -1,39 +1,78 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"net/http"
+	"time"
 
 	"ollama-api-proxy/src/internal/config"
+	"ollama-api-proxy/src/internal/middleware"
 	"ollama-api-proxy/src/internal/router"
 	"ollama-api-proxy/src/internal/state"
+	"ollama-api-proxy/src/internal/telemetry"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 func InitRouterEngine(appState *state.State) *gin.Engine {
 	engine := gin.New()
 
-	engine.SetTrustedProxies(appState.Config.TrustDomains)
+	engine.SetTrustedProxies(appState.Config().TrustDomains)
 	engine.ForwardedByClientIP = true
 
-	engine.Use(gin.Logger())
+	engine.Use(middleware.RequestID())
+	engine.Use(middleware.AccessLog())
 	engine.Use(gin.Recovery())
+	engine.Use(otelgin.Middleware(telemetry.ServiceName))
 
 	router.SetupRouter(engine, appState)
 
 	return engine
 }
 
-func Run(engine *gin.Engine, config *config.Config) error {
-	addr := fmt.Sprintf("%s:%d", config.Host, config.Port)
+// NewHttpClient returns the client shared by all upstream calls. It has no
+// timeout of its own: every call is bounded by its request context, so the
+// timeout follows reloads and per-model settings.
+func NewHttpClient() *http.Client {
+	return &http.Client{
+		Transport: telemetry.NewTransport(http.DefaultTransport),
+	}
+}
+
+// shutdownTimeout bounds how long in-flight requests may take to finish
+// once the server is asked to stop.
+const shutdownTimeout = 30 * time.Second
+
+// Run serves engine until ctx is cancelled, then stops accepting
+// connections and waits for in-flight requests to finish.
+func Run(ctx context.Context, engine *gin.Engine, config *config.Config) error {
+	server := &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", config.Host, config.Port),
+		Handler: engine,
+	}
 
 	slog.Info("Starting server", "address", config.Host, "port", config.Port)
 
-	if err := engine.Run(addr); err != nil {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
 		slog.Error("Failed to start server", "error", err)
 		return fmt.Errorf("failed to start server: %w", err)
+	case <-ctx.Done():
 	}
 
+	slog.Info("Shutting down server")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down server: %w", err)
+	}
 	return nil
 }
@@ -0,0 +1,148 @@
+// anthropic package provides the subset of the Anthropic Messages API the
+// proxy accepts inbound.
+package anthropic
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+type MessagesRequest struct {
+	Model         string          `json:"model"`
+	Messages      []Message       `json:"messages"`
+	System        json.RawMessage `json:"system,omitempty"` // string or text blocks
+	MaxTokens     uint            `json:"max_tokens"`
+	Metadata      *Metadata       `json:"metadata,omitempty"`
+	StopSequences []string        `json:"stop_sequences,omitempty"`
+	Stream        bool            `json:"stream,omitempty"`
+	Temperature   *float64        `json:"temperature,omitempty"`
+	TopP          *float64        `json:"top_p,omitempty"`
+	TopK          int             `json:"top_k,omitempty"`
+	Tools         []Tool          `json:"tools,omitempty"`
+	ToolChoice    *ToolChoice     `json:"tool_choice,omitempty"`
+	Thinking      *Thinking       `json:"thinking,omitempty"`
+}
+
+type Message struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"` // string or content blocks
+}
+
+// ContentBlock is any inbound content block; the fields used depend on Type.
+type ContentBlock struct {
+	Type string `json:"type"`
+	// text
+	Text string `json:"text,omitempty"`
+	// image
+	Source *Source `json:"source,omitempty"`
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+	// tool_result
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"` // string or content blocks
+	IsError   bool            `json:"is_error,omitempty"`
+	// thinking
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+type Source struct {
+	Type      string `json:"type"` // base64 or url
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+type Metadata struct {
+	UserID string `json:"user_id,omitempty"`
+}
+
+type Tool struct {
+	Type        string          `json:"type,omitempty"` // empty or "custom" for client tools
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema,omitempty"`
+}
+
+type ToolChoice struct {
+	Type                   string `json:"type"` // auto, any, tool or none
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
+}
+
+type Thinking struct {
+	Type         string `json:"type"` // enabled or disabled
+	BudgetTokens int    `json:"budget_tokens,omitempty"`
+}
+
+// MessagesResponse is a Messages API response. Content holds TextBlock,
+// ToolUseBlock and ThinkingBlock values.
+type MessagesResponse struct {
+	ID           string  `json:"id"`
+	Type         string  `json:"type"`
+	Role         string  `json:"role"`
+	Model        string  `json:"model"`
+	Content      []any   `json:"content"`
+	StopReason   *string `json:"stop_reason"`
+	StopSequence *string `json:"stop_sequence"`
+	Usage        Usage   `json:"usage"`
+}
+
+type TextBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type ToolUseBlock struct {
+	Type  string          `json:"type"`
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+}
+
+type ThinkingBlock struct {
+	Type      string `json:"type"`
+	Thinking  string `json:"thinking"`
+	Signature string `json:"signature"`
+}
+
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type Error struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+type ErrorResponse struct {
+	Type  string `json:"type"`
+	Error Error  `json:"error"`
+}
+
+// NewError returns an Anthropic error with the type matching the status.
+func NewError(code int, message string) ErrorResponse {
+	var etype string
+	switch code {
+	case http.StatusBadRequest:
+		etype = "invalid_request_error"
+	case http.StatusUnauthorized:
+		etype = "authentication_error"
+	case http.StatusForbidden:
+		etype = "permission_error"
+	case http.StatusNotFound:
+		etype = "not_found_error"
+	case http.StatusRequestEntityTooLarge:
+		etype = "request_too_large"
+	case http.StatusTooManyRequests:
+		etype = "rate_limit_error"
+	case 529:
+		etype = "overloaded_error"
+	default:
+		etype = "api_error"
+	}
+	return ErrorResponse{Type: "error", Error: Error{Type: etype, Message: message}}
+}
@@ -57,6 +57,8 @@ type GeneralOpenAIRequest struct {
 	WebSearchOptions *WebSearchOptions `json:"web_search_options,omitempty"`
   // OpenRouter Params
 	Reasoning json.RawMessage `json:"reasoning,omitempty"`
+	// Ollama options, read by the proxy and not sent upstream
+	Options json.RawMessage `json:"options,omitempty"`
 }
 
 
@@ -390,17 +392,17 @@ type OpenAIResponsesRequest struct {
 	Instructions       json.RawMessage      `json:"instructions,omitempty"`
 	MaxOutputTokens    uint                 `json:"max_output_tokens,omitempty"`
 	Metadata           json.RawMessage      `json:"metadata,omitempty"`
-	ParallelToolCalls  bool                 `json:"parallel_tool_calls,omitempty"`
+	ParallelToolCalls  *bool                `json:"parallel_tool_calls,omitempty"`
 	PreviousResponseID string               `json:"previous_response_id,omitempty"`
 	Reasoning          *Reasoning           `json:"reasoning,omitempty"`
 	ServiceTier        string               `json:"service_tier,omitempty"`
-	Store              bool                 `json:"store,omitempty"`
+	Store              *bool                `json:"store,omitempty"`
 	Stream             bool                 `json:"stream,omitempty"`
-	Temperature        float64              `json:"temperature,omitempty"`
+	Temperature        *float64             `json:"temperature,omitempty"`
 	Text               json.RawMessage      `json:"text,omitempty"`
 	ToolChoice         json.RawMessage      `json:"tool_choice,omitempty"`
 	Tools              []ResponsesToolsCall `json:"tools,omitempty"`
-	TopP               float64              `json:"top_p,omitempty"`
+	TopP               *float64             `json:"top_p,omitempty"`
 	Truncation         string               `json:"truncation,omitempty"`
 	User               string               `json:"user,omitempty"`
 }
@@ -427,4 +429,5 @@ type ResponsesToolsCall struct {
 	Name        string          `json:"name,omitempty"`
 	Description string          `json:"description,omitempty"`
 	Parameters  json.RawMessage `json:"parameters,omitempty"`
+	Strict      *bool           `json:"strict,omitempty"`
 }
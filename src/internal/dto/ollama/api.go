@@ -13,10 +13,11 @@ import (
 	"ollama-api-proxy/src/internal/types/model"
 )
 
-// StatusError is an error with an HTTP status code and message.
+// StatusError is an error with an HTTP status code and message. It
+// marshals to the {"error": ...} body Ollama replies with.
 type StatusError struct {
-	StatusCode   int
-	Status       string
+	StatusCode   int    `json:"-"`
+	Status       string `json:"-"`
 	ErrorMessage string `json:"error"`
 }
 
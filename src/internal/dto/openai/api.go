@@ -3,7 +3,9 @@ package openai
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"ollama-api-proxy/src/internal/dto/ollama"
 )
@@ -22,9 +24,10 @@ type ErrorResponse struct {
 }
 
 type Message struct {
-	Role      string     `json:"role"`
-	Content   any        `json:"content"`
-	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	Role             string     `json:"role,omitempty"`
+	Content          any        `json:"content,omitempty"`
+	ReasoningContent string     `json:"reasoning_content,omitempty"`
+	ToolCalls        []ToolCall `json:"tool_calls,omitempty"`
 }
 
 type Choice struct {
@@ -58,7 +61,6 @@ type StreamOptions struct {
 	IncludeUsage bool `json:"include_usage"`
 }
 
-
 type ChatCompletionRequest struct {
 	Model            string          `json:"model"`
 	Messages         []Message       `json:"messages"`
@@ -96,9 +98,9 @@ type ChatCompletionChunk struct {
 }
 
 type ToolCall struct {
-	ID       string `json:"id"`
+	ID       string `json:"id,omitempty"`
 	Index    int    `json:"index"`
-	Type     string `json:"type"`
+	Type     string `json:"type,omitempty"`
 	Function struct {
 		Name      string `json:"name"`
 		Arguments string `json:"arguments"`
@@ -113,7 +115,7 @@ type Model struct {
 }
 
 type ListModels struct {
-	Object  *string `json:"string,omitempty"`
+	Object  *string `json:"object,omitempty"`
 	Data    []Model `json:"data"`
 	Success *bool   `json:"success,omitempty"`
 }
@@ -125,9 +127,117 @@ func NewError(code int, message string) ErrorResponse {
 		etype = "invalid_request_error"
 	case http.StatusNotFound:
 		etype = "not_found_error"
+	case http.StatusUnauthorized:
+		etype = "authentication_error"
+	case http.StatusForbidden:
+		etype = "permission_error"
+	case http.StatusTooManyRequests:
+		etype = "rate_limit_error"
 	default:
 		etype = "api_error"
 	}
 
 	return ErrorResponse{Error{Type: etype, Message: message}}
 }
+
+// NewModelNotFoundError returns the error OpenAI sends for unknown models.
+func NewModelNotFoundError(model string) ErrorResponse {
+	code := "model_not_found"
+	resp := NewError(http.StatusNotFound, fmt.Sprintf("The model '%s' does not exist", model))
+	resp.Error.Type = "invalid_request_error"
+	resp.Error.Param = "model"
+	resp.Error.Code = &code
+	return resp
+}
+
+// NewContextLengthError returns the error OpenAI sends for prompts that do
+// not fit the model's context window.
+func NewContextLengthError(message string) ErrorResponse {
+	code := "context_length_exceeded"
+	resp := NewError(http.StatusBadRequest, message)
+	resp.Error.Param = "messages"
+	resp.Error.Code = &code
+	return resp
+}
+
+// Completion is a legacy completions response, also used for its stream
+// chunks.
+type Completion struct {
+	Id      string             `json:"id"`
+	Object  string             `json:"object"`
+	Created int64              `json:"created"`
+	Model   string             `json:"model"`
+	Choices []CompletionChoice `json:"choices"`
+	Usage   *Usage             `json:"usage,omitempty"`
+}
+
+type CompletionChoice struct {
+	Text         string  `json:"text"`
+	Index        int     `json:"index"`
+	Logprobs     any     `json:"logprobs"`
+	FinishReason *string `json:"finish_reason"`
+}
+
+// UpstreamError is an error reply of an OpenAI-compatible upstream, for a
+// failed request or sent in place of a stream chunk.
+type UpstreamError struct {
+	// StatusCode is the upstream HTTP status, or 0 for stream errors.
+	StatusCode int
+	Err        Error
+}
+
+func (e *UpstreamError) Error() string {
+	if e.StatusCode == 0 {
+		return e.Err.Message
+	}
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Err.Message)
+}
+
+// maxErrorMessage caps messages taken from non-JSON error bodies, such as
+// HTML error pages of gateways.
+const maxErrorMessage = 512
+
+// ParseError reads an upstream error body: an OpenAI error, the error
+// string some providers send instead, or any other text as the message.
+func ParseError(status int, body []byte) *UpstreamError {
+	var reply struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+	}
+	var detail struct {
+		Message string          `json:"message"`
+		Type    string          `json:"type"`
+		Param   any             `json:"param"`
+		Code    json.RawMessage `json:"code"`
+	}
+	var message string
+	err := NewError(status, "").Error
+	if json.Unmarshal(body, &reply) != nil {
+		message = strings.TrimSpace(string(body))
+		if len(message) > maxErrorMessage {
+			message = message[:maxErrorMessage] + "..."
+		}
+	} else if json.Unmarshal(reply.Error, &message) != nil && json.Unmarshal(reply.Error, &detail) == nil {
+		message = detail.Message
+		if detail.Type != "" {
+			err.Type = detail.Type
+		}
+		err.Param = detail.Param
+		// Some providers send numeric codes.
+		var code string
+		if json.Unmarshal(detail.Code, &code) != nil && len(detail.Code) > 0 && string(detail.Code) != "null" {
+			code = string(detail.Code)
+		}
+		if code != "" {
+			err.Code = &code
+		}
+	}
+	if message == "" {
+		message = reply.Message
+	}
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	err.Message = message
+	return &UpstreamError{StatusCode: status, Err: err}
+}
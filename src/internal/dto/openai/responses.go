@@ -0,0 +1,94 @@
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Response is a Responses API response object. Output holds
+// ResponseMessage, ResponseFunctionCall and ResponseReasoning items.
+type Response struct {
+	Id                 string             `json:"id"`
+	Object             string             `json:"object"`
+	CreatedAt          int64              `json:"created_at"`
+	Status             string             `json:"status"`
+	Error              *Error             `json:"error"`
+	IncompleteDetails  *IncompleteDetails `json:"incomplete_details"`
+	Instructions       json.RawMessage    `json:"instructions"`
+	MaxOutputTokens    *uint              `json:"max_output_tokens"`
+	Model              string             `json:"model"`
+	Output             []any              `json:"output"`
+	ParallelToolCalls  bool               `json:"parallel_tool_calls"`
+	PreviousResponseID *string            `json:"previous_response_id"`
+	Store              bool               `json:"store"`
+	Temperature        *float64           `json:"temperature"`
+	ToolChoice         json.RawMessage    `json:"tool_choice"`
+	Tools              json.RawMessage    `json:"tools"`
+	TopP               *float64           `json:"top_p"`
+	Usage              *ResponseUsage     `json:"usage"`
+	Metadata           json.RawMessage    `json:"metadata"`
+}
+
+type IncompleteDetails struct {
+	Reason string `json:"reason"`
+}
+
+type ResponseMessage struct {
+	Type    string           `json:"type"`
+	Id      string           `json:"id"`
+	Status  string           `json:"status"`
+	Role    string           `json:"role"`
+	Content []ResponseOutput `json:"content"`
+}
+
+// ResponseOutput is an output_text content part.
+type ResponseOutput struct {
+	Type        string `json:"type"`
+	Text        string `json:"text"`
+	Annotations []any  `json:"annotations"`
+}
+
+type ResponseFunctionCall struct {
+	Type      string `json:"type"`
+	Id        string `json:"id"`
+	Status    string `json:"status"`
+	CallId    string `json:"call_id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+type ResponseReasoning struct {
+	Type    string            `json:"type"`
+	Id      string            `json:"id"`
+	Summary []ResponseSummary `json:"summary"`
+}
+
+// ResponseSummary is a summary_text part of a reasoning item.
+type ResponseSummary struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type ResponseUsage struct {
+	InputTokens        int `json:"input_tokens"`
+	InputTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+	OutputTokens        int `json:"output_tokens"`
+	OutputTokensDetails struct {
+		ReasoningTokens int `json:"reasoning_tokens"`
+	} `json:"output_tokens_details"`
+	TotalTokens int `json:"total_tokens"`
+}
+
+// NewPreviousResponseNotFoundError returns the error OpenAI sends for an
+// unknown previous_response_id.
+func NewPreviousResponseNotFoundError(id string) ErrorResponse {
+	code := "previous_response_not_found"
+	resp := NewError(http.StatusNotFound, fmt.Sprintf("Previous response with id '%s' not found.", id))
+	resp.Error.Type = "invalid_request_error"
+	resp.Error.Param = "previous_response_id"
+	resp.Error.Code = &code
+	return resp
+}
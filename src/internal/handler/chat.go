@@ -4,15 +4,27 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
+	"ollama-api-proxy/src/internal/cache"
+	"ollama-api-proxy/src/internal/capture"
+	"ollama-api-proxy/src/internal/config"
 	"ollama-api-proxy/src/internal/dto/newapi"
 	"ollama-api-proxy/src/internal/dto/openai"
+	"ollama-api-proxy/src/internal/middleware"
 	"ollama-api-proxy/src/internal/state"
+	"ollama-api-proxy/src/internal/stream"
+	"ollama-api-proxy/src/internal/telemetry"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func ChatCompletion(appState *state.State) gin.HandlerFunc {
@@ -26,87 +38,354 @@ func ChatCompletion(appState *state.State) gin.HandlerFunc {
 			return
 		}
 
-		if appState.Models != nil {
-			if m, err := appState.Models.GetModel(req.Model); err == nil {
-				req.MaxTokens = uint(m.OutputTokens)
-			} else {
-				req.MaxTokens = 0
-			}
-		} else {
-			req.MaxTokens = 0
-		}
+		cfg := appState.Config()
+		models := appState.Models()
 
-		// slog.Debug("ChatCompletion request received", "max_tokens", req.MaxTokens, "model", req.Model, "MaxCompletionTokens", req.MaxCompletionTokens)
+		requestedModel := req.Model
+		modelInfo, modelName := resolveModel(models, req.Model)
+		if !appState.Visibility().Visible(modelName, models) {
+			c.AbortWithStatusJSON(http.StatusNotFound, openai.NewError(http.StatusNotFound, fmt.Sprintf("model '%s' not found", req.Model)))
+			return
+		}
+		defer withDeadline(c, cfg, modelInfo)()
 
-		baseUrl, err := url.Parse(appState.Config.OpenAIBaseURL)
+		baseUrl, err := url.Parse(cfg.OpenAIBaseURL)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, "Invalid base URL"))
 			return
 		}
+		tagRequest(c, req.Model, baseUrl.Host, req.Stream)
 
-		payload, err := json.Marshal(req)
+		var captureFlag *bool
+		if modelInfo != nil {
+			captureFlag = modelInfo.GetCapture()
+		}
+		// Usage is always requested upstream, for the access log; the client
+		// only gets the usage chunk when it asked for one.
+		includeUsage := req.StreamOptions != nil && req.StreamOptions.IncludeUsage
+		if req.Stream {
+			req.StreamOptions = &newapi.StreamOptions{IncludeUsage: true}
+		}
+		payload, err := preparePayload(c, appState, &req, modelInfo, modelName)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, "Failed to marshal request payload"))
+			abortPrepare(c, err)
 			return
 		}
 
-		httpRequest, err := http.NewRequest(
-			http.MethodPost,
-			baseUrl.JoinPath("/chat/completions").String(),
-			bytes.NewBuffer(payload),
-		)
+		var cacheKey string
+		if appState.Cache != nil && isDeterministic(&req) {
+			cacheKey = cache.Key(cfg, payload)
+			if hasCacheDirective(c, "no-cache") {
+				c.Header("X-Cache", "BYPASS")
+			} else if entry, ok := appState.Cache.Get(cacheKey); ok && entry.Stream == req.Stream {
+				c.Header("X-Cache", "HIT")
+				serveCached(c, entry, req.Model, requestedModel, includeUsage)
+				return
+			} else {
+				c.Header("X-Cache", "MISS")
+			}
+			if hasCacheDirective(c, "no-store") {
+				cacheKey = ""
+			}
+		}
+
+		httpRequest, err := newUpstreamRequest(c, cfg, baseUrl.JoinPath("/chat/completions"), payload, req.Stream)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, "Failed to create HTTP request"))
 			return
 		}
 
-		httpRequest.Header.Set("Authorization", "Bearer "+appState.Config.OpenAIAPIKey)
-		httpRequest.Header.Set("Content-Type", "application/json")
-
 		if req.Stream {
-			httpRequest.Header.Set("Accept", "text/event-stream")
-			httpRequest.Header.Set("Cache-Control", "no-cache")
-			httpRequest.Header.Set("Connection", "keep-alive")
-
-			httpResponse, err := appState.HttpClient.Do(httpRequest)
+			httpResponse, err := sendUpstream(c, appState, httpRequest, true)
 			if err != nil {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, "Failed to send request to OpenAI API"))
+				abortUpstream(c, err)
 				return
 			}
 			defer httpResponse.Body.Close()
 
+			if httpResponse.StatusCode != http.StatusOK {
+				abortUpstream(c, captureUpstreamError(c, appState, captureFlag, &req, payload, httpResponse))
+				return
+			}
+
 			c.Writer.Header().Set("Content-Type", "text/event-stream")
 			c.Writer.Header().Set("Cache-Control", "no-cache")
 			c.Writer.Header().Set("Connection", "keep-alive")
 			c.Writer.Header().Set("Transfer-Encoding", "chunked")
 
-			c.Stream(func(w io.Writer) bool {
-				if _, err := io.Copy(w, httpResponse.Body); err != nil {
-					return false
+			_, span := telemetry.Tracer().Start(c.Request.Context(), "chat.stream", trace.WithAttributes(
+				telemetry.AttrModel.String(req.Model),
+			))
+			defer span.End()
+
+			var assembler *capture.StreamAssembler
+			if appState.Capture.ShouldCapture(captureFlag) {
+				assembler = &capture.StreamAssembler{}
+				defer func() {
+					writeCapture(c, appState.Capture, &req, payload, httpResponse.StatusCode, assembler.Message())
+				}()
+			}
+
+			var cached *bytes.Buffer
+			if cacheKey != "" {
+				cached = &bytes.Buffer{}
+			}
+
+			decoder := stream.NewOpenAIDecoder(httpResponse.Body)
+			decoder.KeepRaw = true
+			decoder.OnData = func(data []byte) {
+				if cached != nil {
+					fmt.Fprintf(cached, "data: %s\n\n", data)
 				}
-				return false
-			})
+				if assembler != nil {
+					assembler.Add(data)
+				}
+			}
+			encoder := stream.NewOpenAIEncoder(c.Writer, requestedModel, includeUsage)
+			if err := relay(c, span, decoder, encoder); err != nil {
+				span.SetStatus(codes.Error, err.Error())
+				return
+			}
+			if cached != nil {
+				appState.Cache.Set(cacheKey, &cache.Entry{Stream: true, Body: cached.Bytes(), Created: time.Now()})
+			}
 
 		} else {
-			httpResponse, err := appState.HttpClient.Do(httpRequest)
+			httpResponse, err := sendUpstream(c, appState, httpRequest, false)
 			if err != nil {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, "Failed to send request to OpenAI API"))
+				abortUpstream(c, err)
 				return
 			}
 			defer httpResponse.Body.Close()
 
 			if httpResponse.StatusCode != http.StatusOK {
-				c.AbortWithStatusJSON(httpResponse.StatusCode, openai.NewError(httpResponse.StatusCode, "OpenAI API error"))
+				abortUpstream(c, captureUpstreamError(c, appState, captureFlag, &req, payload, httpResponse))
 				return
 			}
 
 			body, err := io.ReadAll(httpResponse.Body)
 			if err != nil {
-				c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, "Failed to read response from OpenAI API"))
+				abortUpstream(c, err)
 				return
 			}
 
+			if appState.Capture.ShouldCapture(captureFlag) {
+				writeCapture(c, appState.Capture, &req, payload, httpResponse.StatusCode, body)
+			}
+
+			if cacheKey != "" {
+				appState.Cache.Set(cacheKey, &cache.Entry{Stream: false, Body: body, Created: time.Now()})
+			}
+
+			var completion openai.ChatCompletion
+			if err := json.Unmarshal(body, &completion); err == nil {
+				recordUsage(c, trace.SpanFromContext(c.Request.Context()), &completion.Usage)
+			}
+
+			if req.Model != requestedModel {
+				body = replaceModel(body, requestedModel)
+			}
 			c.Data(http.StatusOK, "application/json", body)
 		}
 	}
 }
+
+// tagRequest records the model, provider and stream flag of an inbound
+// request on the access log and the request span.
+func tagRequest(c *gin.Context, model, provider string, stream bool) {
+	c.Set(middleware.KeyModel, model)
+	c.Set(middleware.KeyProvider, provider)
+	c.Set(middleware.KeyStream, stream)
+	trace.SpanFromContext(c.Request.Context()).SetAttributes(
+		telemetry.AttrModel.String(model),
+		telemetry.AttrProvider.String(provider),
+		telemetry.AttrStream.Bool(stream),
+	)
+}
+
+// preparePayload maps req to the upstream model and applies the model's
+// parameters, truncation and context window. The returned payload is what
+// is sent upstream; of the fields the model's parameters may change, req
+// only follows the ones the handlers read. A *contextError means the prompt
+// does not fit.
+func preparePayload(c *gin.Context, appState *state.State, req *newapi.GeneralOpenAIRequest, modelInfo *config.ModelInfo, modelName string) ([]byte, error) {
+	_, span := telemetry.Tracer().Start(c.Request.Context(), "chat.translate")
+	defer span.End()
+
+	if modelInfo != nil {
+		req.Model = modelInfo.GetUpstreamName()
+	} else {
+		req.Model = modelName
+		req.Options = nil
+	}
+
+	payload, err := json.Marshal(req)
+	if err == nil && modelInfo != nil {
+		payload, err = applyParameters(payload, modelInfo)
+		if err == nil {
+			err = syncParameters(payload, req)
+		}
+	}
+	if err == nil && modelInfo != nil {
+		var truncated int
+		payload, truncated, err = truncateMessages(payload, req, modelInfo, appState.Tokenizer)
+		if truncated > 0 {
+			c.Header(TruncatedHeader, strconv.Itoa(truncated))
+		}
+	}
+	if err == nil && modelInfo != nil {
+		var promptTokens int
+		payload, promptTokens, err = enforceContextWindow(payload, req, modelInfo, appState.Tokenizer)
+		if promptTokens > 0 {
+			span.SetAttributes(telemetry.AttrPromptTokens.Int(promptTokens))
+		}
+	}
+	return payload, err
+}
+
+// syncParameters copies the sampling fields the cache reads from payload
+// to req, after the model's parameters were applied.
+func syncParameters(payload []byte, req *newapi.GeneralOpenAIRequest) error {
+	var fields struct {
+		Temperature *float64 `json:"temperature"`
+		N           int      `json:"n"`
+	}
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return err
+	}
+	req.Temperature = fields.Temperature
+	req.N = fields.N
+	return nil
+}
+
+// abortPrepare writes the OpenAI error for a preparePayload failure.
+func abortPrepare(c *gin.Context, err error) {
+	var contextErr *contextError
+	if errors.As(err, &contextErr) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewContextLengthError(contextErr.Error()))
+		return
+	}
+	c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, "Failed to marshal request payload"))
+}
+
+// newUpstreamRequest builds an authenticated POST of payload to endpoint.
+func newUpstreamRequest(c *gin.Context, cfg *config.Config, endpoint *url.URL, payload []byte, stream bool) (*http.Request, error) {
+	// The request context ends the upstream call when the client goes away
+	// or the deadline passes, and traces it as a child of the inbound request.
+	httpRequest, err := http.NewRequestWithContext(
+		c.Request.Context(),
+		http.MethodPost,
+		endpoint.String(),
+		bytes.NewBuffer(payload),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	httpRequest.Header.Set("Authorization", "Bearer "+cfg.OpenAIAPIKey)
+	httpRequest.Header.Set("Content-Type", "application/json")
+	httpRequest.Header.Set(middleware.RequestIDHeader, c.GetString(middleware.KeyRequestID))
+	if stream {
+		httpRequest.Header.Set("Accept", "text/event-stream")
+		httpRequest.Header.Set("Cache-Control", "no-cache")
+		httpRequest.Header.Set("Connection", "keep-alive")
+	}
+	return httpRequest, nil
+}
+
+// isDeterministic reports whether a request may be answered from the cache.
+// Only requests that pin temperature to zero are considered repeatable.
+func isDeterministic(req *newapi.GeneralOpenAIRequest) bool {
+	return req.Temperature != nil && *req.Temperature == 0 && req.N <= 1
+}
+
+func hasCacheDirective(c *gin.Context, directive string) bool {
+	for value := range strings.SplitSeq(c.GetHeader("Cache-Control"), ",") {
+		if strings.EqualFold(strings.TrimSpace(value), directive) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveCached replays a cached response and records its usage like a fresh
+// one. Streams are replayed chunk by chunk with the requested model and
+// usage option applied.
+func serveCached(c *gin.Context, entry *cache.Entry, upstreamModel, requestedModel string, includeUsage bool) {
+	span := trace.SpanFromContext(c.Request.Context())
+	if !entry.Stream {
+		body := entry.Body
+		var completion openai.ChatCompletion
+		if err := json.Unmarshal(body, &completion); err == nil {
+			recordUsage(c, span, &completion.Usage)
+		}
+		if upstreamModel != requestedModel {
+			body = replaceModel(body, requestedModel)
+		}
+		c.Data(http.StatusOK, "application/json", body)
+		return
+	}
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+
+	decoder := stream.NewOpenAIDecoder(bytes.NewReader(entry.Body))
+	decoder.KeepRaw = true
+	if err := relay(c, span, decoder, stream.NewOpenAIEncoder(c.Writer, requestedModel, includeUsage)); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// replaceModel sets the top-level model of a JSON body, e.g. to the name
+// the client asked for in a reply or the upstream name in a request.
+func replaceModel(body []byte, model string) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return body
+	}
+	if _, ok := fields["model"]; !ok {
+		return body
+	}
+	fields["model"], _ = json.Marshal(model)
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+// captureUpstreamError reads the error reply of a non-200 upstream response
+// and captures it like any other response.
+func captureUpstreamError(c *gin.Context, appState *state.State, captureFlag *bool, req *newapi.GeneralOpenAIRequest, payload []byte, resp *http.Response) *openai.UpstreamError {
+	body := readErrorBody(resp)
+	if appState.Capture.ShouldCapture(captureFlag) {
+		writeCapture(c, appState.Capture, req, payload, resp.StatusCode, body)
+	}
+	return openai.ParseError(resp.StatusCode, body)
+}
+
+// writeCapture records the payload sent upstream and the response received.
+func writeCapture(c *gin.Context, recorder *capture.Recorder, req *newapi.GeneralOpenAIRequest, payload []byte, status int, response []byte) {
+	recorder.Write(&capture.Record{
+		Time:      time.Now(),
+		RequestID: c.GetString(middleware.KeyRequestID),
+		Path:      c.Request.URL.Path,
+		Model:     req.Model,
+		Stream:    req.Stream,
+		Status:    status,
+		Request:   payload,
+		Response:  response,
+	})
+}
+
+// recordUsage attaches token counts to the span and the access log.
+func recordUsage(c *gin.Context, span trace.Span, usage *openai.Usage) {
+	c.Set(middleware.KeyPromptTokens, usage.PromptTokens)
+	c.Set(middleware.KeyCompletionTokens, usage.CompletionTokens)
+	span.SetAttributes(
+		telemetry.AttrPromptTokens.Int(usage.PromptTokens),
+		telemetry.AttrCompletionTokens.Int(usage.CompletionTokens),
+		telemetry.AttrTotalTokens.Int(usage.TotalTokens),
+	)
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ollama-api-proxy/src/internal/cache"
+	"ollama-api-proxy/src/internal/capture"
+	"ollama-api-proxy/src/internal/config"
+	"ollama-api-proxy/src/internal/middleware"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChatCompletionCapturesUpstreamErrors(t *testing.T) {
+	appState := testState(t, "", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"error":{"message":"slow down","type":"rate_limit_error"}}`)
+	})
+	cfg := config.Default()
+	cfg.CaptureEnabled = true
+	cfg.CaptureDir = t.TempDir()
+	recorder, err := capture.New(cfg)
+	require.NoError(t, err)
+	appState.Capture = recorder
+
+	w := serve(ChatCompletion(appState), `{"model":"gpt-4.1","messages":[{"role":"user","content":"hi"}]}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.NoError(t, recorder.Close())
+
+	files, _ := filepath.Glob(filepath.Join(cfg.CaptureDir, "capture-*.jsonl"))
+	require.Len(t, files, 1)
+	line, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	var record capture.Record
+	require.NoError(t, json.Unmarshal(line, &record))
+	assert.Equal(t, http.StatusTooManyRequests, record.Status, "Failed exchanges should be captured too")
+	assert.JSONEq(t, `{"error":{"message":"slow down","type":"rate_limit_error"}}`, string(record.Response))
+}
+
+func TestServeCachedRecordsUsage(t *testing.T) {
+	entry := &cache.Entry{Body: []byte(`{"id":"c1","object":"chat.completion","model":"gpt-4.1","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}`)}
+	c, w := testContext()
+	serveCached(c, entry, "gpt-4.1", "gpt", false)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"model":"gpt"`)
+	assert.Equal(t, 5, c.GetInt(middleware.KeyPromptTokens), "Cache hits should be accounted like fresh responses")
+	assert.Equal(t, 2, c.GetInt(middleware.KeyCompletionTokens))
+}
@@ -0,0 +1,314 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"ollama-api-proxy/src/internal/capture"
+	"ollama-api-proxy/src/internal/config"
+	"ollama-api-proxy/src/internal/dto/newapi"
+	"ollama-api-proxy/src/internal/dto/openai"
+	"ollama-api-proxy/src/internal/state"
+	"ollama-api-proxy/src/internal/stream"
+	"ollama-api-proxy/src/internal/telemetry"
+	"ollama-api-proxy/src/internal/types/model"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Completions serves the legacy completions API. Models configured with
+// completions_api "passthrough" are forwarded to the upstream /completions
+// endpoint; all others are emulated with a chat completion, rendering
+// fill-in-the-middle requests (those with a suffix) with the model's FIM
+// template. A prefix is appended to the prompt, so either may carry the code
+// before the insertion point.
+func Completions(appState *state.State) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := c.GetRawData()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+		if len(bytes.TrimSpace(body)) == 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, "Request body is empty"))
+			return
+		}
+		var req completionRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		cfg := appState.Config()
+		models := appState.Models()
+
+		requestedModel := req.Model
+		modelInfo, modelName := resolveModel(models, req.Model)
+		if !appState.Visibility().Visible(modelName, models) {
+			c.AbortWithStatusJSON(http.StatusNotFound, openai.NewError(http.StatusNotFound, fmt.Sprintf("model '%s' not found", req.Model)))
+			return
+		}
+		defer withDeadline(c, cfg, modelInfo)()
+
+		baseUrl, err := url.Parse(cfg.OpenAIBaseURL)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, "Invalid base URL"))
+			return
+		}
+		tagRequest(c, req.Model, baseUrl.Host, req.Stream)
+
+		if modelInfo != nil && modelInfo.GetCompletionsAPI() == "passthrough" {
+			passthrough(c, appState, baseUrl.JoinPath("/completions"), body, req.Model, modelInfo.GetUpstreamName(), req.Stream, stream.WriteOpenAIError)
+			return
+		}
+
+		if err := req.emulated(); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+		prompt, err := completionPrompt(req.Prompt)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+		if req.Prefix != nil {
+			prefix, ok := req.Prefix.(string)
+			if !ok {
+				c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, "prefix must be a string"))
+				return
+			}
+			prompt += prefix
+		}
+		if suffix, _ := req.Suffix.(string); suffix != "" {
+			fimTemplate := config.DefaultFIMTemplate
+			if modelInfo != nil {
+				if !slices.Contains(modelInfo.GetCapabilities(), model.CapabilityInsert) {
+					c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, fmt.Sprintf("model '%s' does not support insert", requestedModel)))
+					return
+				}
+				fimTemplate = modelInfo.GetFIMTemplate()
+			}
+			if prompt, err = renderFIM(fimTemplate, prompt, suffix); err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, "Invalid FIM template"))
+				return
+			}
+		}
+
+		message := newapi.Message{Role: "user"}
+		message.SetStringContent(prompt)
+		req.Messages = []newapi.Message{message}
+		req.Prompt, req.Prefix, req.Suffix = nil, nil, nil
+
+		var captureFlag *bool
+		if modelInfo != nil {
+			captureFlag = modelInfo.GetCapture()
+		}
+		payload, err := preparePayload(c, appState, &req.GeneralOpenAIRequest, modelInfo, modelName)
+		if err != nil {
+			abortPrepare(c, err)
+			return
+		}
+
+		httpRequest, err := newUpstreamRequest(c, cfg, baseUrl.JoinPath("/chat/completions"), payload, req.Stream)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, "Failed to create HTTP request"))
+			return
+		}
+
+		httpResponse, err := sendUpstream(c, appState, httpRequest, req.Stream)
+		if err != nil {
+			abortUpstream(c, err)
+			return
+		}
+		defer httpResponse.Body.Close()
+
+		if httpResponse.StatusCode != http.StatusOK {
+			abortUpstream(c, captureUpstreamError(c, appState, captureFlag, &req.GeneralOpenAIRequest, payload, httpResponse))
+			return
+		}
+
+		encoder := &completionEncoder{completion: openai.Completion{
+			Id:      "cmpl-" + newItemID(),
+			Object:  "text_completion",
+			Created: time.Now().Unix(),
+			Model:   requestedModel,
+			Choices: []openai.CompletionChoice{},
+		}}
+
+		if !req.Stream {
+			body, err := io.ReadAll(httpResponse.Body)
+			if err != nil {
+				abortUpstream(c, err)
+				return
+			}
+			if appState.Capture.ShouldCapture(captureFlag) {
+				writeCapture(c, appState.Capture, &req.GeneralOpenAIRequest, payload, httpResponse.StatusCode, body)
+			}
+
+			events, err := stream.DecodeOpenAICompletion(body)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadGateway, openai.NewError(http.StatusBadGateway, "Invalid response from OpenAI API"))
+				return
+			}
+			recordEventUsage(c, trace.SpanFromContext(c.Request.Context()), events)
+			encoder.Encode(events)
+			c.JSON(http.StatusOK, encoder.completion)
+			return
+		}
+
+		c.Writer.Header().Set("Content-Type", "text/event-stream")
+		c.Writer.Header().Set("Cache-Control", "no-cache")
+		c.Writer.Header().Set("Connection", "keep-alive")
+
+		_, span := telemetry.Tracer().Start(c.Request.Context(), "completions.stream", trace.WithAttributes(
+			telemetry.AttrModel.String(req.Model),
+		))
+		defer span.End()
+
+		var assembler *capture.StreamAssembler
+		if appState.Capture.ShouldCapture(captureFlag) {
+			assembler = &capture.StreamAssembler{}
+			defer func() {
+				writeCapture(c, appState.Capture, &req.GeneralOpenAIRequest, payload, httpResponse.StatusCode, assembler.Message())
+			}()
+		}
+
+		decoder := stream.NewOpenAIDecoder(httpResponse.Body)
+		if assembler != nil {
+			decoder.OnData = assembler.Add
+		}
+		encoder.w = c.Writer
+		if err := relay(c, span, decoder, encoder); err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+}
+
+// completionRequest is a legacy completion request. The options below have
+// other types than their chat namesakes, or no chat counterpart at all, so
+// they are decoded here rather than in GeneralOpenAIRequest.
+type completionRequest struct {
+	newapi.GeneralOpenAIRequest
+	LogProbs any  `json:"logprobs,omitempty"`
+	Echo     bool `json:"echo,omitempty"`
+	BestOf   int  `json:"best_of,omitempty"`
+}
+
+// emulated reports the options a chat completion cannot emulate; they need a
+// model with completions_api "passthrough".
+func (r *completionRequest) emulated() error {
+	var unsupported []string
+	if r.Echo {
+		unsupported = append(unsupported, "echo")
+	}
+	if r.BestOf > 1 {
+		unsupported = append(unsupported, "best_of")
+	}
+	if r.LogProbs != nil {
+		unsupported = append(unsupported, "logprobs")
+	}
+	if len(unsupported) == 0 {
+		return nil
+	}
+	return fmt.Errorf("unsupported options: %s; use a model with completions_api 'passthrough'", strings.Join(unsupported, ", "))
+}
+
+// completionEncoder writes events as legacy completion chunks, or collects
+// them into completion when w is nil.
+type completionEncoder struct {
+	w          io.Writer
+	completion openai.Completion
+}
+
+func (e *completionEncoder) Encode(events []stream.Event) error {
+	out := &e.completion
+	if e.w != nil {
+		chunk := e.completion
+		chunk.Choices = []openai.CompletionChoice{}
+		out = &chunk
+	}
+	for _, event := range events {
+		switch event.Type {
+		case stream.Text:
+			e.choice(out, event.Choice).Text += event.Text
+		case stream.Finish:
+			reason := event.Reason
+			e.choice(out, event.Choice).FinishReason = &reason
+		case stream.Usage:
+			out.Usage = event.Usage
+		}
+	}
+	if e.w == nil || len(out.Choices) == 0 && out.Usage == nil {
+		return nil
+	}
+	data, err := json.Marshal(out)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.w, "data: %s\n\n", data)
+	return err
+}
+
+func (e *completionEncoder) Close() error {
+	if e.w == nil {
+		return nil
+	}
+	_, err := io.WriteString(e.w, "data: [DONE]\n\n")
+	return err
+}
+
+func (e *completionEncoder) Fail(err error) error {
+	return stream.WriteOpenAIError(e.w, err)
+}
+
+// choice returns the completion's choice with the index, adding it when
+// missing.
+func (e *completionEncoder) choice(completion *openai.Completion, index int) *openai.CompletionChoice {
+	for i := range completion.Choices {
+		if completion.Choices[i].Index == index {
+			return &completion.Choices[i]
+		}
+	}
+	completion.Choices = append(completion.Choices, openai.CompletionChoice{Index: index})
+	return &completion.Choices[len(completion.Choices)-1]
+}
+
+// completionPrompt returns the prompt of an emulated completion, a string or
+// a list holding one string.
+func completionPrompt(prompt any) (string, error) {
+	switch prompt := prompt.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return prompt, nil
+	case []any:
+		if len(prompt) == 1 {
+			if text, ok := prompt[0].(string); ok {
+				return text, nil
+			}
+		}
+	}
+	return "", errors.New("prompt must be a string; batches and token prompts need a model with completions_api 'passthrough'")
+}
+
+// renderFIM renders a fill-in-the-middle prompt from the template.
+func renderFIM(text, prefix, suffix string) (string, error) {
+	tmpl, err := template.New("fim").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var out strings.Builder
+	err = tmpl.Execute(&out, struct{ Prefix, Suffix string }{prefix, suffix})
+	return out.String(), err
+}
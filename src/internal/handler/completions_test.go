@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"ollama-api-proxy/src/internal/config"
+	"ollama-api-proxy/src/internal/dto/newapi"
+	"ollama-api-proxy/src/internal/dto/openai"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const completionModels = `
+models:
+  - name: "coder"
+    upstream_name: "gpt-4.1"
+    config:
+      capabilities: ["completion", "insert"]
+      fim_template: "<PRE>{{.Prefix}}<SUF>{{.Suffix}}<MID>"
+  - name: "chat"
+    config:
+      capabilities: ["completion"]
+  - name: "legacy"
+    upstream_name: "gpt-3.5-turbo-instruct"
+    config:
+      completions_api: "passthrough"
+`
+
+func TestRenderFIM(t *testing.T) {
+	prompt, err := renderFIM("<PRE>{{.Prefix}}<SUF>{{.Suffix}}<MID>", "func add(", "}")
+	require.NoError(t, err)
+	assert.Equal(t, "<PRE>func add(<SUF>}<MID>", prompt)
+
+	prompt, err = renderFIM(config.DefaultFIMTemplate, "a <b>", "c")
+	require.NoError(t, err)
+	assert.Contains(t, prompt, "<prefix>a <b></prefix>\n<suffix>c</suffix>", "Text templates should not escape the code")
+
+	_, err = renderFIM("{{.Missing}}", "a", "b")
+	assert.Error(t, err)
+}
+
+func TestCompletionPrompt(t *testing.T) {
+	tests := []struct {
+		prompt any
+		want   string
+		err    bool
+	}{
+		{nil, "", false},
+		{"hello", "hello", false},
+		{[]any{"hello"}, "hello", false},
+		{[]any{"a", "b"}, "", true},
+		{[]any{1.0, 2.0}, "", true},
+	}
+	for _, tt := range tests {
+		prompt, err := completionPrompt(tt.prompt)
+		assert.Equal(t, tt.want, prompt)
+		assert.Equal(t, tt.err, err != nil, "%v", tt.prompt)
+	}
+}
+
+func TestCompletionsEmulated(t *testing.T) {
+	requests := make(chan newapi.GeneralOpenAIRequest, 1)
+	handler := Completions(testState(t, completionModels, chatUpstream(t, "Hello", requests)))
+
+	w := serve(handler, `{"model":"coder","prompt":"func add(","suffix":"}"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	req := <-requests
+	assert.Equal(t, "gpt-4.1", req.Model)
+	assert.Equal(t, []string{"user: <PRE>func add(<SUF>}<MID>"}, messageContents(req.Messages))
+	assert.Nil(t, req.Suffix, "The suffix should not be sent to chat completions")
+
+	var completion openai.Completion
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &completion))
+	assert.Equal(t, "text_completion", completion.Object)
+	assert.Equal(t, "coder", completion.Model)
+	assert.Equal(t, "Hello", completion.Choices[0].Text)
+	assert.Equal(t, "stop", *completion.Choices[0].FinishReason)
+
+	w = serve(handler, `{"model":"chat","prompt":"a","suffix":"b"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Models without insert should reject suffixes")
+}
+
+func TestCompletionsEmulatedPrefix(t *testing.T) {
+	requests := make(chan newapi.GeneralOpenAIRequest, 1)
+	handler := Completions(testState(t, completionModels, chatUpstream(t, "Hello", requests)))
+
+	w := serve(handler, `{"model":"coder","prefix":"func add(","suffix":"}"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	req := <-requests
+	assert.Equal(t, []string{"user: <PRE>func add(<SUF>}<MID>"}, messageContents(req.Messages))
+	assert.Nil(t, req.Prefix, "The prefix should not be sent to chat completions")
+
+	w = serve(handler, `{"model":"coder","prompt":"package main\n","prefix":"func add(","suffix":"}"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"user: <PRE>package main\nfunc add(<SUF>}<MID>"}, messageContents((<-requests).Messages),
+		"The prefix should follow the prompt")
+
+	w = serve(handler, `{"model":"coder","prefix":["a"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCompletionsEmulatedUnsupported(t *testing.T) {
+	handler := Completions(testState(t, completionModels, chatUpstream(t, "Hello", nil)))
+
+	for _, body := range []string{
+		`{"model":"chat","prompt":"a","echo":true}`,
+		`{"model":"chat","prompt":"a","best_of":2}`,
+		`{"model":"chat","prompt":"a","logprobs":0}`,
+	} {
+		w := serve(handler, body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		assert.Contains(t, w.Body.String(), "completions_api 'passthrough'", body)
+	}
+
+	w := serve(handler, `{"model":"chat","prompt":"a","echo":false,"best_of":1}`)
+	assert.Equal(t, http.StatusOK, w.Code, "Defaults should be accepted: %s", w.Body.String())
+}
+
+func TestCompletionsEmulatedStream(t *testing.T) {
+	handler := Completions(testState(t, completionModels, chatUpstream(t, "Hello", nil)))
+
+	w := serve(handler, `{"model":"chat","prompt":"say hello","stream":true}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var text strings.Builder
+	events := strings.Split(strings.TrimSpace(w.Body.String()), "\n\n")
+	assert.Equal(t, "data: [DONE]", events[len(events)-1])
+	for _, event := range events[:len(events)-1] {
+		var chunk openai.Completion
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(event, "data: ")), &chunk))
+		assert.Equal(t, "text_completion", chunk.Object)
+		for _, choice := range chunk.Choices {
+			text.WriteString(choice.Text)
+		}
+	}
+	assert.Equal(t, "Hello", text.String())
+}
+
+func TestCompletionsPassthrough(t *testing.T) {
+	var path, model string
+	handler := Completions(testState(t, completionModels, func(w http.ResponseWriter, r *http.Request) {
+		var req map[string]any
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &req)
+		path, model = r.URL.Path, req["model"].(string)
+		io.WriteString(w, `{"object":"text_completion","model":"gpt-3.5-turbo-instruct","choices":[{"index":0,"text":"x","finish_reason":"stop"}]}`)
+	}))
+
+	w := serve(handler, `{"model":"legacy","prompt":["a","b"],"echo":true,"logprobs":5}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "/completions", path)
+	assert.Equal(t, "gpt-3.5-turbo-instruct", model)
+	assert.Contains(t, w.Body.String(), `"model":"legacy"`)
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"ollama-api-proxy/src/internal/config"
+	"ollama-api-proxy/src/internal/dto/newapi"
+	"ollama-api-proxy/src/internal/tokenizer"
+)
+
+// contextError is returned when a prompt does not fit the model's window.
+type contextError struct {
+	message string
+}
+
+func (e *contextError) Error() string {
+	return e.message
+}
+
+// modelEncoding returns the tokenizer encoding configured for the model or
+// the one matching its upstream name.
+func modelEncoding(info *config.ModelInfo) string {
+	if encoding := info.GetTokenizer(); encoding != "" {
+		return encoding
+	}
+	return tokenizer.EncodingForModel(info.GetUpstreamName())
+}
+
+// countPrompt returns the prompt tokens of the messages and tool definitions
+// of req, and whether the count is exact.
+func countPrompt(req *newapi.GeneralOpenAIRequest, info *config.ModelInfo, tok *tokenizer.Tokenizer) (int, bool) {
+	encoding := modelEncoding(info)
+	promptTokens, exact := tok.CountMessages(encoding, req.Messages)
+	if len(req.Tools) > 0 {
+		tools, _ := json.Marshal(req.Tools)
+		n, _ := tok.Count(encoding, string(tools))
+		promptTokens += n
+	}
+	return promptTokens, exact
+}
+
+// enforceContextWindow counts the prompt tokens of req and checks them
+// against the model's configured limits. Prompts over the input limit are
+// rejected. The output budget is the output limit, or the space left in the
+// window when that is smaller: a larger max_tokens or max_completion_tokens
+// is clamped to it in payload, and it is set when the client asked for
+// neither. Only exact counts reject a request, since an estimate may be off
+// in either direction.
+func enforceContextWindow(payload []byte, req *newapi.GeneralOpenAIRequest, info *config.ModelInfo, tok *tokenizer.Tokenizer) ([]byte, int, error) {
+	inputLimit := info.GetInputTokens()
+	outputLimit := info.GetOutputTokens()
+	if inputLimit == 0 && outputLimit == 0 {
+		return payload, 0, nil
+	}
+
+	promptTokens, exact := countPrompt(req, info, tok)
+
+	if inputLimit > 0 && promptTokens > inputLimit && exact {
+		return nil, promptTokens, &contextError{fmt.Sprintf(
+			"This model's maximum input length is %d tokens. However, your messages resulted in %d tokens.",
+			inputLimit, promptTokens)}
+	}
+	if outputLimit == 0 {
+		return payload, promptTokens, nil
+	}
+
+	budget := outputLimit
+	if inputLimit > 0 {
+		available := info.GetContextLength() - promptTokens
+		if available < 1 {
+			if exact {
+				return nil, promptTokens, &contextError{fmt.Sprintf(
+					"This model's maximum context length is %d tokens. However, your messages resulted in %d tokens.",
+					info.GetContextLength(), promptTokens)}
+			}
+			return payload, promptTokens, nil
+		}
+		budget = min(budget, available)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, promptTokens, err
+	}
+	changed, present := false, false
+	for _, key := range []string{"max_tokens", "max_completion_tokens"} {
+		if _, ok := fields[key]; !ok {
+			continue
+		}
+		present = true
+		var limit int
+		if err := json.Unmarshal(fields[key], &limit); err != nil || limit <= budget {
+			continue
+		}
+		fields[key], _ = json.Marshal(budget)
+		changed = true
+	}
+	if key := outputTokensField(info); !present && key != "" {
+		fields[key], _ = json.Marshal(budget)
+		changed = true
+	}
+	if !changed {
+		return payload, promptTokens, nil
+	}
+	payload, err := json.Marshal(fields)
+	return payload, promptTokens, err
+}
+
+// outputTokensField returns the request field that limits the reply of the
+// model, after its compatibility rules, or "" when the model's config
+// removes it.
+func outputTokensField(info *config.ModelInfo) string {
+	field := "max_tokens"
+	if compat := info.GetCompat(); compat != nil {
+		if renamed, ok := compat.Rename[field]; ok {
+			field = renamed
+		}
+		if slices.Contains(compat.Drop, field) {
+			return ""
+		}
+	}
+	if _, ok := info.GetOverrides()[field]; ok {
+		return ""
+	}
+	return field
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ollama-api-proxy/src/internal/config"
+	"ollama-api-proxy/src/internal/dto/newapi"
+	"ollama-api-proxy/src/internal/tokenizer"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testModels loads a models file from yml.
+func testModels(t *testing.T, yml string) *config.Models {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "models.yml")
+	require.NoError(t, os.WriteFile(path, []byte(yml), 0o644))
+	models, err := config.LoadModels(path)
+	require.NoError(t, err)
+	return models
+}
+
+func testModel(t *testing.T, models *config.Models, name string) *config.ModelInfo {
+	t.Helper()
+	info, err := models.GetModel(name)
+	require.NoError(t, err)
+	return info
+}
+
+// testTokenizer counts one token per byte for cl100k_base.
+func testTokenizer() *tokenizer.Tokenizer {
+	return tokenizer.New("../tokenizer/testdata")
+}
+
+const contextModels = `
+models:
+  - name: "exact"
+    config:
+      tokenizer: "cl100k_base"
+      input_tokens: 20
+      output_tokens: 10
+  - name: "estimate"
+    config:
+      tokenizer: "estimate"
+      input_tokens: 20
+      output_tokens: 10
+  - name: "input-only"
+    config:
+      tokenizer: "cl100k_base"
+      input_tokens: 20
+  - name: "reasoning"
+    config:
+      tokenizer: "cl100k_base"
+      input_tokens: 20
+      output_tokens: 10
+      compat:
+        profile: "openai-reasoning"
+  - name: "unlimited"
+    config:
+      tokenizer: "cl100k_base"
+      input_tokens: 20
+      output_tokens: 10
+      overrides:
+        max_tokens: null
+`
+
+func TestEnforceContextWindow(t *testing.T) {
+	models := testModels(t, contextModels)
+	tok := testTokenizer()
+
+	// A user message adds 3 + 3 + len("user") tokens to its content, counted
+	// one per byte; estimates count a token per four characters.
+	tests := []struct {
+		name    string
+		model   string
+		content string
+		fields  string
+		want    map[string]any
+		prompt  int
+		err     bool
+	}{
+		{"within budget", "exact", "hello", `"max_tokens":5`, map[string]any{"max_tokens": 5.0}, 15, false},
+		{"clamped to output limit", "exact", "hello", `"max_tokens":100`, map[string]any{"max_tokens": 10.0}, 15, false},
+		{"completion tokens clamped", "exact", "hello", `"max_completion_tokens":100`, map[string]any{"max_completion_tokens": 10.0}, 15, false},
+		{"set when absent", "exact", "hello", ``, map[string]any{"max_tokens": 10.0}, 15, false},
+		{"prompt at input limit", "exact", strings.Repeat("a", 10), ``, map[string]any{"max_tokens": 10.0}, 20, false},
+		{"prompt over input limit", "exact", strings.Repeat("a", 11), ``, nil, 21, true},
+		{"estimate over input limit clamped to window", "estimate", strings.Repeat("a", 80), `"max_tokens":100`, map[string]any{"max_tokens": 3.0}, 27, false},
+		{"estimate over input limit set to window", "estimate", strings.Repeat("a", 80), ``, map[string]any{"max_tokens": 3.0}, 27, false},
+		{"estimate over window passed on", "estimate", strings.Repeat("a", 120), `"max_tokens":100`, map[string]any{"max_tokens": 100.0}, 37, false},
+		{"no output limit", "input-only", "hello", `"max_tokens":100`, map[string]any{"max_tokens": 100.0}, 15, false},
+		{"renamed field set when absent", "reasoning", "hello", ``, map[string]any{"max_completion_tokens": 10.0}, 15, false},
+		{"removed field not set", "unlimited", "hello", ``, map[string]any{}, 15, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &newapi.GeneralOpenAIRequest{Model: tt.model, Messages: []newapi.Message{{Role: "user"}}}
+			req.Messages[0].SetStringContent(tt.content)
+			payload := `{"model":"` + tt.model + `"`
+			if tt.fields != "" {
+				payload += "," + tt.fields
+			}
+			payload += "}"
+
+			out, prompt, err := enforceContextWindow([]byte(payload), req, testModel(t, models, tt.model), tok)
+			assert.Equal(t, tt.prompt, prompt)
+			if tt.err {
+				var contextErr *contextError
+				assert.ErrorAs(t, err, &contextErr)
+				return
+			}
+			require.NoError(t, err)
+
+			var fields map[string]any
+			require.NoError(t, json.Unmarshal(out, &fields))
+			delete(fields, "model")
+			assert.Equal(t, tt.want, fields)
+		})
+	}
+}
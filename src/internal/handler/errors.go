@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+
+	"ollama-api-proxy/src/internal/dto/anthropic"
+	"ollama-api-proxy/src/internal/dto/ollama"
+	"ollama-api-proxy/src/internal/dto/openai"
+	"ollama-api-proxy/src/internal/middleware"
+	"ollama-api-proxy/src/internal/stream"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readUpstreamError reads the error reply of a non-200 upstream response.
+func readUpstreamError(resp *http.Response) *openai.UpstreamError {
+	return openai.ParseError(resp.StatusCode, readErrorBody(resp))
+}
+
+// readErrorBody reads up to 1 MiB of an upstream error reply.
+func readErrorBody(resp *http.Response) []byte {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	return body
+}
+
+// upstreamStatus maps a failed upstream call to the status returned to the
+// client. Client errors are passed on, including rejected credentials, so
+// clients can tell a bad key from an outage; server errors become 502 unless
+// they are about availability.
+func upstreamStatus(err error) int {
+	var upstreamErr *openai.UpstreamError
+	if errors.As(err, &upstreamErr) {
+		switch status := upstreamErr.StatusCode; {
+		case status >= 400 && status < 500:
+			return status
+		case status == http.StatusServiceUnavailable, status == http.StatusGatewayTimeout:
+			return status
+		default:
+			return http.StatusBadGateway
+		}
+	}
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, stream.ErrIdleTimeout) || errors.As(err, &netErr) && netErr.Timeout() {
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// upstreamError returns the status and the OpenAI error for a failed
+// upstream call, keeping the message, type, code and param of upstream
+// errors.
+func upstreamError(err error) (int, openai.Error) {
+	status := upstreamStatus(err)
+	var upstreamErr *openai.UpstreamError
+	if errors.As(err, &upstreamErr) {
+		return status, upstreamErr.Err
+	}
+	if status == http.StatusGatewayTimeout {
+		return status, openai.NewError(status, stream.ErrorMessage(context.DeadlineExceeded)).Error
+	}
+	return status, openai.NewError(status, "Upstream API request failed").Error
+}
+
+// markAborted records why a request was aborted when err comes from the
+// client going away, the deadline passing or the upstream stream stalling.
+func markAborted(c *gin.Context, err error) {
+	var reason string
+	switch ctxErr := c.Request.Context().Err(); {
+	case errors.Is(err, stream.ErrIdleTimeout):
+		reason = middleware.AbortIdle
+	case errors.Is(ctxErr, context.DeadlineExceeded):
+		reason = middleware.AbortDeadline
+	case errors.Is(ctxErr, context.Canceled):
+		reason = middleware.AbortClient
+	default:
+		return
+	}
+	c.Set(middleware.KeyAborted, reason)
+}
+
+// abortUpstream writes the OpenAI error for a failed upstream call.
+func abortUpstream(c *gin.Context, err error) {
+	markAborted(c, err)
+	status, upstreamErr := upstreamError(err)
+	c.AbortWithStatusJSON(status, openai.ErrorResponse{Error: upstreamErr})
+}
+
+// abortOllamaUpstream writes the Ollama error for a failed upstream call.
+func abortOllamaUpstream(c *gin.Context, err error) {
+	markAborted(c, err)
+	status, upstreamErr := upstreamError(err)
+	c.AbortWithStatusJSON(status, ollama.StatusError{
+		StatusCode:   status,
+		Status:       http.StatusText(status),
+		ErrorMessage: upstreamErr.Message,
+	})
+}
+
+// abortAnthropicUpstream writes the Anthropic error for a failed upstream
+// call.
+func abortAnthropicUpstream(c *gin.Context, err error) {
+	markAborted(c, err)
+	status, upstreamErr := upstreamError(err)
+	c.AbortWithStatusJSON(status, anthropic.NewError(status, upstreamErr.Message))
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"ollama-api-proxy/src/internal/dto/openai"
+	"ollama-api-proxy/src/internal/stream"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpstreamError(t *testing.T) {
+	tests := []struct {
+		err     error
+		status  int
+		message string
+	}{
+		{openai.ParseError(http.StatusUnauthorized, []byte(`{"error":{"message":"Incorrect API key provided","type":"invalid_request_error"}}`)), http.StatusUnauthorized, "Incorrect API key provided"},
+		{openai.ParseError(http.StatusForbidden, []byte(`{"error":{"message":"Model access denied"}}`)), http.StatusForbidden, "Model access denied"},
+		{openai.ParseError(http.StatusTooManyRequests, []byte(`{"error":{"message":"Rate limit reached"}}`)), http.StatusTooManyRequests, "Rate limit reached"},
+		{openai.ParseError(http.StatusServiceUnavailable, []byte(`overloaded`)), http.StatusServiceUnavailable, "overloaded"},
+		{openai.ParseError(http.StatusInternalServerError, []byte(`{"error":{"message":"boom"}}`)), http.StatusBadGateway, "boom"},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout, stream.ErrorMessage(context.DeadlineExceeded)},
+		{stream.ErrIdleTimeout, http.StatusGatewayTimeout, stream.ErrorMessage(context.DeadlineExceeded)},
+		{io.ErrUnexpectedEOF, http.StatusBadGateway, "Upstream API request failed"},
+	}
+	for _, tt := range tests {
+		status, upstreamErr := upstreamError(tt.err)
+		assert.Equal(t, tt.status, status, "%v", tt.err)
+		assert.Equal(t, tt.message, upstreamErr.Message, "%v", tt.err)
+	}
+}
+
+func TestChatCompletionRejectedKey(t *testing.T) {
+	handler := ChatCompletion(testState(t, "", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"error":{"message":"Incorrect API key provided","type":"invalid_request_error","code":"invalid_api_key"}}`)
+	}))
+
+	w := serve(handler, `{"model":"gpt-4.1","messages":[{"role":"user","content":"hi"}]}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "A rejected key should not look like an outage")
+	assert.JSONEq(t, `{"error":{"message":"Incorrect API key provided","type":"invalid_request_error","param":null,"code":"invalid_api_key"}}`, w.Body.String())
+}
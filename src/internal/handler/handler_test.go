@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ollama-api-proxy/src/internal/config"
+	"ollama-api-proxy/src/internal/conversation"
+	"ollama-api-proxy/src/internal/state"
+
+	"github.com/gin-gonic/gin"
+)
+
+// testState returns a state whose upstream is served by upstream, with the
+// models of yml when set.
+func testState(t *testing.T, yml string, upstream http.HandlerFunc) *state.State {
+	t.Helper()
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+
+	cfg := config.Default()
+	cfg.OpenAIBaseURL = server.URL
+	appState := &state.State{
+		HttpClient:    server.Client(),
+		Tokenizer:     testTokenizer(),
+		Conversations: conversation.NewStore(10, 0),
+	}
+	appState.SetConfig(cfg)
+	if yml != "" {
+		appState.SetModels(testModels(t, yml))
+	}
+	return appState
+}
+
+// serve sends a POST of body to handler.
+func serve(handler gin.HandlerFunc, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.POST("/", handler)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	return w
+}
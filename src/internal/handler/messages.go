@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"ollama-api-proxy/src/internal/capture"
+	"ollama-api-proxy/src/internal/dto/anthropic"
+	"ollama-api-proxy/src/internal/state"
+	"ollama-api-proxy/src/internal/stream"
+	"ollama-api-proxy/src/internal/telemetry"
+	"ollama-api-proxy/src/internal/types/model"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Messages serves the Anthropic Messages API by translating requests to chat
+// completions for the configured upstream, and the replies back to Anthropic
+// messages and stream events.
+func Messages(appState *state.State) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req anthropic.MessagesRequest
+		if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, anthropic.NewError(http.StatusBadRequest, "Request body is empty"))
+			return
+		} else if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, anthropic.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		cfg := appState.Config()
+		models := appState.Models()
+
+		requestedModel := req.Model
+		modelInfo, modelName := resolveModel(models, req.Model)
+		if !appState.Visibility().Visible(modelName, models) {
+			c.AbortWithStatusJSON(http.StatusNotFound, anthropic.NewError(http.StatusNotFound, fmt.Sprintf("model: %s", req.Model)))
+			return
+		}
+		defer withDeadline(c, cfg, modelInfo)()
+
+		baseUrl, err := url.Parse(cfg.OpenAIBaseURL)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, anthropic.NewError(http.StatusInternalServerError, "Invalid base URL"))
+			return
+		}
+		tagRequest(c, req.Model, baseUrl.Host, req.Stream)
+
+		thinking := modelInfo == nil || slices.Contains(modelInfo.GetCapabilities(), model.CapabilityThinking)
+		chatReq, err := translateMessagesRequest(&req, thinking)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, anthropic.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		var captureFlag *bool
+		if modelInfo != nil {
+			captureFlag = modelInfo.GetCapture()
+		}
+		payload, err := preparePayload(c, appState, chatReq, modelInfo, modelName)
+		if err != nil {
+			var contextErr *contextError
+			if errors.As(err, &contextErr) {
+				c.AbortWithStatusJSON(http.StatusBadRequest, anthropic.NewError(http.StatusBadRequest, "prompt is too long: "+contextErr.Error()))
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, anthropic.NewError(http.StatusInternalServerError, "Failed to marshal request payload"))
+			return
+		}
+
+		httpRequest, err := newUpstreamRequest(c, cfg, baseUrl.JoinPath("/chat/completions"), payload, req.Stream)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, anthropic.NewError(http.StatusInternalServerError, "Failed to create HTTP request"))
+			return
+		}
+
+		httpResponse, err := sendUpstream(c, appState, httpRequest, req.Stream)
+		if err != nil {
+			abortAnthropicUpstream(c, err)
+			return
+		}
+		defer httpResponse.Body.Close()
+
+		if httpResponse.StatusCode != http.StatusOK {
+			abortAnthropicUpstream(c, captureUpstreamError(c, appState, captureFlag, chatReq, payload, httpResponse))
+			return
+		}
+
+		if !req.Stream {
+			body, err := io.ReadAll(httpResponse.Body)
+			if err != nil {
+				abortAnthropicUpstream(c, err)
+				return
+			}
+			if appState.Capture.ShouldCapture(captureFlag) {
+				writeCapture(c, appState.Capture, chatReq, payload, httpResponse.StatusCode, body)
+			}
+
+			events, err := stream.DecodeOpenAICompletion(body)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadGateway, anthropic.NewError(http.StatusBadGateway, "Invalid response from upstream API"))
+				return
+			}
+			recordEventUsage(c, trace.SpanFromContext(c.Request.Context()), events)
+
+			builder := newMessageBuilder(requestedModel, nil)
+			builder.Encode(events)
+			builder.Close()
+			c.JSON(http.StatusOK, builder.resp)
+			return
+		}
+
+		c.Writer.Header().Set("Content-Type", "text/event-stream")
+		c.Writer.Header().Set("Cache-Control", "no-cache")
+		c.Writer.Header().Set("Connection", "keep-alive")
+
+		_, span := telemetry.Tracer().Start(c.Request.Context(), "messages.stream", trace.WithAttributes(
+			telemetry.AttrModel.String(chatReq.Model),
+		))
+		defer span.End()
+
+		var assembler *capture.StreamAssembler
+		if appState.Capture.ShouldCapture(captureFlag) {
+			assembler = &capture.StreamAssembler{}
+			defer func() {
+				writeCapture(c, appState.Capture, chatReq, payload, httpResponse.StatusCode, assembler.Message())
+			}()
+		}
+
+		builder := newMessageBuilder(requestedModel, func(event string, data gin.H) {
+			c.SSEvent(event, data)
+			c.Writer.Flush()
+		})
+		builder.start()
+
+		decoder := stream.NewOpenAIDecoder(httpResponse.Body)
+		if assembler != nil {
+			decoder.OnData = assembler.Add
+		}
+		if err := relay(c, span, decoder, builder); err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+}
@@ -0,0 +1,385 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"ollama-api-proxy/src/internal/dto/anthropic"
+	"ollama-api-proxy/src/internal/dto/newapi"
+	"ollama-api-proxy/src/internal/dto/openai"
+	"ollama-api-proxy/src/internal/stream"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Anthropic stop reasons by OpenAI finish reason.
+var stopReasons = map[string]string{
+	"stop":           "end_turn",
+	"length":         "max_tokens",
+	"tool_calls":     "tool_use",
+	"function_call":  "tool_use",
+	"content_filter": "refusal",
+}
+
+// translateMessagesRequest converts an Anthropic Messages request into a chat
+// completion request. thinking reports whether the model accepts a
+// reasoning effort.
+func translateMessagesRequest(req *anthropic.MessagesRequest, thinking bool) (*newapi.GeneralOpenAIRequest, error) {
+	chatReq := &newapi.GeneralOpenAIRequest{
+		Model:       req.Model,
+		Stream:      req.Stream,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		TopK:        req.TopK,
+	}
+	if req.TopP != nil {
+		chatReq.TopP = *req.TopP
+	}
+	if len(req.StopSequences) > 0 {
+		chatReq.Stop = req.StopSequences
+	}
+	if req.Metadata != nil {
+		chatReq.User = req.Metadata.UserID
+	}
+	if req.Stream {
+		chatReq.StreamOptions = &newapi.StreamOptions{IncludeUsage: true}
+	}
+	if req.Thinking != nil && req.Thinking.Type == "enabled" && thinking {
+		chatReq.ReasoningEffort = reasoningEffort(req.Thinking.BudgetTokens)
+	}
+
+	if isSet(req.System) {
+		system, err := blocksText(req.System)
+		if err != nil {
+			return nil, fmt.Errorf("system: %w", err)
+		}
+		message := newapi.Message{Role: "system"}
+		message.SetStringContent(system)
+		chatReq.Messages = append(chatReq.Messages, message)
+	}
+	for i, message := range req.Messages {
+		messages, err := translateAnthropicMessage(message)
+		if err != nil {
+			return nil, fmt.Errorf("messages[%d]: %w", i, err)
+		}
+		chatReq.Messages = append(chatReq.Messages, messages...)
+	}
+
+	for _, tool := range req.Tools {
+		if tool.Type != "" && tool.Type != "custom" {
+			return nil, fmt.Errorf("tool type '%s' is not supported", tool.Type)
+		}
+		function := newapi.FunctionRequest{Name: tool.Name, Description: tool.Description}
+		if len(tool.InputSchema) > 0 {
+			function.Parameters = tool.InputSchema
+		}
+		chatReq.Tools = append(chatReq.Tools, newapi.ToolCallRequest{Type: "function", Function: function})
+	}
+
+	if choice := req.ToolChoice; choice != nil {
+		switch choice.Type {
+		case "auto", "none":
+			chatReq.ToolChoice = choice.Type
+		case "any":
+			chatReq.ToolChoice = "required"
+		case "tool":
+			chatReq.ToolChoice = map[string]any{"type": "function", "function": map[string]string{"name": choice.Name}}
+		default:
+			return nil, fmt.Errorf("tool_choice type '%s' is not supported", choice.Type)
+		}
+		if choice.DisableParallelToolUse {
+			parallel := false
+			chatReq.ParallelTooCalls = &parallel
+		}
+	}
+
+	return chatReq, nil
+}
+
+// reasoningEffort maps an Anthropic thinking budget to an OpenAI effort.
+func reasoningEffort(budget int) string {
+	switch {
+	case budget < 4096:
+		return "low"
+	case budget < 16384:
+		return "medium"
+	default:
+		return "high"
+	}
+}
+
+// translateAnthropicMessage converts one Anthropic message into chat
+// messages. Tool results become tool messages ahead of the rest of the user
+// turn; thinking blocks are dropped.
+func translateAnthropicMessage(message anthropic.Message) ([]newapi.Message, error) {
+	if message.Role != "user" && message.Role != "assistant" {
+		return nil, fmt.Errorf("role '%s' is not supported", message.Role)
+	}
+
+	var text string
+	if err := json.Unmarshal(message.Content, &text); err == nil {
+		out := newapi.Message{Role: message.Role}
+		out.SetStringContent(text)
+		return []newapi.Message{out}, nil
+	}
+	var blocks []anthropic.ContentBlock
+	if err := json.Unmarshal(message.Content, &blocks); err != nil {
+		return nil, errors.New("content must be a string or a list of blocks")
+	}
+
+	var messages []newapi.Message
+	var contents []newapi.MediaContent
+	var calls []newapi.ToolCallRequest
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			contents = append(contents, newapi.MediaContent{Type: newapi.ContentTypeText, Text: block.Text})
+		case "image":
+			imageUrl, err := imageSourceURL(block.Source)
+			if err != nil {
+				return nil, err
+			}
+			contents = append(contents, newapi.MediaContent{Type: newapi.ContentTypeImageURL, ImageUrl: map[string]string{"url": imageUrl}})
+		case "tool_use":
+			arguments := "{}"
+			if isSet(block.Input) {
+				arguments = string(block.Input)
+			}
+			calls = append(calls, newapi.ToolCallRequest{
+				ID:       block.ID,
+				Type:     "function",
+				Function: newapi.FunctionRequest{Name: block.Name, Arguments: arguments},
+			})
+		case "tool_result":
+			result, err := blocksText(block.Content)
+			if err != nil {
+				return nil, fmt.Errorf("tool_result: %w", err)
+			}
+			if block.IsError {
+				result = "Error: " + result
+			}
+			tool := newapi.Message{Role: "tool", ToolCallId: block.ToolUseID}
+			tool.SetStringContent(result)
+			messages = append(messages, tool)
+		case "thinking", "redacted_thinking":
+		default:
+			return nil, fmt.Errorf("content block type '%s' is not supported", block.Type)
+		}
+	}
+
+	if message.Role == "assistant" {
+		out := newapi.Message{Role: "assistant"}
+		var text strings.Builder
+		for _, content := range contents {
+			text.WriteString(content.Text)
+		}
+		if text.Len() > 0 || len(calls) == 0 {
+			out.SetStringContent(text.String())
+		} else {
+			out.SetNullContent()
+		}
+		if len(calls) > 0 {
+			out.SetToolCalls(calls)
+		}
+		return append(messages, out), nil
+	}
+	if len(contents) > 0 {
+		out := newapi.Message{Role: "user"}
+		out.SetMediaContent(contents)
+		messages = append(messages, out)
+	}
+	return messages, nil
+}
+
+// blocksText returns a string or the text of a list of text blocks.
+func blocksText(raw json.RawMessage) (string, error) {
+	if !isSet(raw) {
+		return "", nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil
+	}
+	var blocks []anthropic.ContentBlock
+	if err := json.Unmarshal(raw, &blocks); err != nil {
+		return "", errors.New("content must be a string or a list of blocks")
+	}
+	var out strings.Builder
+	for _, block := range blocks {
+		if block.Type == "text" {
+			out.WriteString(block.Text)
+		}
+	}
+	return out.String(), nil
+}
+
+func imageSourceURL(source *anthropic.Source) (string, error) {
+	switch {
+	case source == nil:
+		return "", errors.New("image without source")
+	case source.Type == "base64":
+		return "data:" + source.MediaType + ";base64," + source.Data, nil
+	case source.Type == "url":
+		return source.URL, nil
+	default:
+		return "", fmt.Errorf("image source type '%s' is not supported", source.Type)
+	}
+}
+
+// messageBuilder assembles an Anthropic message from chat completion output.
+// When emit is set, every change is also reported as a streaming event.
+type messageBuilder struct {
+	resp *anthropic.MessagesResponse
+	emit func(event string, data gin.H)
+
+	// open is the index of the content block being streamed, or -1.
+	open  int
+	kind  string
+	calls map[int]int
+	// arguments collects the streamed tool call arguments by block index;
+	// they are parsed into the tool input at Close.
+	arguments map[int]*strings.Builder
+	reason    string
+	usage     *openai.Usage
+}
+
+func newMessageBuilder(model string, emit func(event string, data gin.H)) *messageBuilder {
+	return &messageBuilder{
+		resp: &anthropic.MessagesResponse{
+			ID:      "msg_" + newItemID(),
+			Type:    "message",
+			Role:    "assistant",
+			Model:   model,
+			Content: []any{},
+		},
+		emit:      emit,
+		open:      -1,
+		calls:     make(map[int]int),
+		arguments: make(map[int]*strings.Builder),
+	}
+}
+
+func (b *messageBuilder) event(event string, data gin.H) {
+	if b.emit == nil {
+		return
+	}
+	data["type"] = event
+	b.emit(event, data)
+}
+
+func (b *messageBuilder) start() {
+	b.event("message_start", gin.H{"message": b.resp})
+}
+
+// add starts a new content block, stopping the open one first.
+func (b *messageBuilder) add(kind string, block any) int {
+	b.stop()
+	b.open = len(b.resp.Content)
+	b.kind = kind
+	b.resp.Content = append(b.resp.Content, block)
+	b.event("content_block_start", gin.H{"index": b.open, "content_block": block})
+	return b.open
+}
+
+func (b *messageBuilder) stop() {
+	if b.open < 0 {
+		return
+	}
+	b.event("content_block_stop", gin.H{"index": b.open})
+	b.open = -1
+}
+
+func (b *messageBuilder) addThinking(delta string) {
+	if delta == "" {
+		return
+	}
+	if b.kind != "thinking" || b.open < 0 {
+		b.add("thinking", &anthropic.ThinkingBlock{Type: "thinking"})
+	}
+	b.resp.Content[b.open].(*anthropic.ThinkingBlock).Thinking += delta
+	b.event("content_block_delta", gin.H{"index": b.open, "delta": gin.H{"type": "thinking_delta", "thinking": delta}})
+}
+
+func (b *messageBuilder) addText(delta string) {
+	if delta == "" {
+		return
+	}
+	if b.kind != "text" || b.open < 0 {
+		b.add("text", &anthropic.TextBlock{Type: "text"})
+	}
+	b.resp.Content[b.open].(*anthropic.TextBlock).Text += delta
+	b.event("content_block_delta", gin.H{"index": b.open, "delta": gin.H{"type": "text_delta", "text": delta}})
+}
+
+// Encode adds the events of the first choice to the message.
+func (b *messageBuilder) Encode(events []stream.Event) error {
+	for _, event := range events {
+		if event.Type != stream.Usage && event.Choice != 0 {
+			continue
+		}
+		switch event.Type {
+		case stream.Reasoning:
+			b.addThinking(event.Text)
+		case stream.Text:
+			b.addText(event.Text)
+		case stream.ToolCall:
+			b.addToolCall(event.Call)
+		case stream.Finish:
+			b.reason = event.Reason
+		case stream.Usage:
+			b.usage = event.Usage
+		}
+	}
+	return nil
+}
+
+// addToolCall adds a complete tool call or a streamed fragment of one.
+func (b *messageBuilder) addToolCall(call stream.Call) {
+	index, ok := b.calls[call.Index]
+	if !ok || index != b.open {
+		id := call.ID
+		if id == "" {
+			id = "toolu_" + newItemID()
+		}
+		index = b.add("tool_use", &anthropic.ToolUseBlock{Type: "tool_use", ID: id, Name: call.Name, Input: json.RawMessage("{}")})
+		b.calls[call.Index] = index
+		b.arguments[index] = &strings.Builder{}
+	}
+	if call.Arguments == "" {
+		return
+	}
+	b.arguments[index].WriteString(call.Arguments)
+	b.event("content_block_delta", gin.H{"index": index, "delta": gin.H{"type": "input_json_delta", "partial_json": call.Arguments}})
+}
+
+// Fail ends the stream with an error event.
+func (b *messageBuilder) Fail(err error) error {
+	b.event("error", gin.H{"error": anthropic.NewError(upstreamStatus(err), stream.ErrorMessage(err)).Error})
+	return nil
+}
+
+// Close ends the message with the upstream finish reason and usage.
+func (b *messageBuilder) Close() error {
+	b.stop()
+	for index, args := range b.arguments {
+		if input := args.String(); json.Valid([]byte(input)) {
+			b.resp.Content[index].(*anthropic.ToolUseBlock).Input = json.RawMessage(input)
+		}
+	}
+	stopReason, ok := stopReasons[b.reason]
+	if !ok {
+		stopReason = "end_turn"
+	}
+	b.resp.StopReason = &stopReason
+	if b.usage != nil {
+		b.resp.Usage = anthropic.Usage{InputTokens: b.usage.PromptTokens, OutputTokens: b.usage.CompletionTokens}
+	}
+	b.event("message_delta", gin.H{
+		"delta": gin.H{"stop_reason": stopReason, "stop_sequence": nil},
+		"usage": b.resp.Usage,
+	})
+	b.event("message_stop", gin.H{})
+	return nil
+}
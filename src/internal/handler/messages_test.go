@@ -0,0 +1,149 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"ollama-api-proxy/src/internal/dto/anthropic"
+	"ollama-api-proxy/src/internal/dto/openai"
+	"ollama-api-proxy/src/internal/stream"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslateMessagesRequest(t *testing.T) {
+	var req anthropic.MessagesRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"model": "claude",
+		"max_tokens": 1024,
+		"system": [{"type":"text","text":"You are "},{"type":"text","text":"helpful."}],
+		"thinking": {"type":"enabled","budget_tokens":8000},
+		"tool_choice": {"type":"any","disable_parallel_tool_use":true},
+		"tools": [{"name":"weather","description":"Get the weather","input_schema":{"type":"object"}}],
+		"messages": [
+			{"role":"user","content":"Weather in Paris?"},
+			{"role":"assistant","content":[
+				{"type":"thinking","thinking":"use the tool","signature":"sig"},
+				{"type":"text","text":"Let me check."},
+				{"type":"tool_use","id":"toolu_1","name":"weather","input":{"city":"Paris"}},
+				{"type":"tool_use","id":"toolu_2","name":"weather"}]},
+			{"role":"user","content":[
+				{"type":"tool_result","tool_use_id":"toolu_1","content":[{"type":"text","text":"sunny"}]},
+				{"type":"tool_result","tool_use_id":"toolu_2","content":"no city","is_error":true},
+				{"type":"text","text":"Thanks"}]}
+		]}`), &req))
+
+	chatReq, err := translateMessagesRequest(&req, true)
+	require.NoError(t, err)
+	out, err := json.Marshal(chatReq.Messages)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"role":"system","content":"You are helpful."},
+		{"role":"user","content":"Weather in Paris?"},
+		{"role":"assistant","content":"Let me check.","tool_calls":[
+			{"id":"toolu_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Paris\"}"}},
+			{"id":"toolu_2","type":"function","function":{"name":"weather","arguments":"{}"}}]},
+		{"role":"tool","content":"sunny","tool_call_id":"toolu_1"},
+		{"role":"tool","content":"Error: no city","tool_call_id":"toolu_2"},
+		{"role":"user","content":[{"type":"text","text":"Thanks"}]}
+	]`, string(out))
+
+	assert.Equal(t, uint(1024), chatReq.MaxTokens)
+	assert.Equal(t, "medium", chatReq.ReasoningEffort)
+	assert.Equal(t, "required", chatReq.ToolChoice)
+	assert.False(t, *chatReq.ParallelTooCalls)
+	require.Len(t, chatReq.Tools, 1)
+	assert.Equal(t, "weather", chatReq.Tools[0].Function.Name)
+
+	chatReq, err = translateMessagesRequest(&req, false)
+	require.NoError(t, err)
+	assert.Empty(t, chatReq.ReasoningEffort, "Models without thinking should not get a reasoning effort")
+}
+
+func TestTranslateMessagesRequestErrors(t *testing.T) {
+	for _, body := range []string{
+		`{"model":"claude","messages":[{"role":"system","content":"x"}]}`,
+		`{"model":"claude","messages":[{"role":"user","content":[{"type":"document"}]}]}`,
+		`{"model":"claude","messages":[{"role":"user","content":"x"}],"tools":[{"type":"web_search_20250305","name":"web"}]}`,
+	} {
+		var req anthropic.MessagesRequest
+		require.NoError(t, json.Unmarshal([]byte(body), &req))
+		_, err := translateMessagesRequest(&req, true)
+		assert.Error(t, err, body)
+	}
+}
+
+func TestMessageBuilderStopReason(t *testing.T) {
+	tests := map[string]string{
+		"stop":           "end_turn",
+		"length":         "max_tokens",
+		"tool_calls":     "tool_use",
+		"content_filter": "refusal",
+		"":               "end_turn",
+	}
+	for reason, want := range tests {
+		builder := newMessageBuilder("claude", nil)
+		builder.Encode([]stream.Event{{Type: stream.Text, Text: "hi"}, {Type: stream.Finish, Reason: reason}})
+		builder.Close()
+		assert.Equal(t, want, *builder.resp.StopReason, reason)
+	}
+}
+
+func TestMessageBuilderStream(t *testing.T) {
+	var names []string
+	builder := newMessageBuilder("claude", func(event string, data gin.H) {
+		names = append(names, event)
+	})
+	builder.start()
+	builder.Encode([]stream.Event{{Type: stream.Reasoning, Text: "hmm"}})
+	builder.Encode([]stream.Event{{Type: stream.Text, Text: "Checking."}})
+	builder.Encode([]stream.Event{{Type: stream.ToolCall, Call: stream.Call{ID: "call_1", Name: "weather"}}})
+	builder.Encode([]stream.Event{{Type: stream.ToolCall, Call: stream.Call{Arguments: `{"city":`}}})
+	builder.Encode([]stream.Event{{Type: stream.ToolCall, Call: stream.Call{Arguments: `"Paris"}`}}})
+	builder.Encode([]stream.Event{
+		{Type: stream.Finish, Reason: "tool_calls"},
+		{Type: stream.Usage, Usage: &openai.Usage{PromptTokens: 5, CompletionTokens: 2}},
+	})
+	builder.Close()
+
+	assert.Equal(t, []string{
+		"message_start",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_delta", "content_block_stop",
+		"message_delta", "message_stop",
+	}, names)
+
+	require.Len(t, builder.resp.Content, 3)
+	call := builder.resp.Content[2].(*anthropic.ToolUseBlock)
+	assert.Equal(t, "call_1", call.ID)
+	assert.JSONEq(t, `{"city":"Paris"}`, string(call.Input), "Streamed arguments should become the tool input")
+	assert.Equal(t, "tool_use", *builder.resp.StopReason)
+	assert.Equal(t, anthropic.Usage{InputTokens: 5, OutputTokens: 2}, builder.resp.Usage)
+}
+
+func TestMessages(t *testing.T) {
+	handler := Messages(testState(t, "", chatUpstream(t, "Hello", nil)))
+
+	w := serve(handler, `{"model":"gpt-4.1","max_tokens":100,"messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.JSONEq(t, `{
+		"type":"message","role":"assistant","model":"gpt-4.1",
+		"content":[{"type":"text","text":"Hello"}],
+		"stop_reason":"end_turn","stop_sequence":null,
+		"usage":{"input_tokens":5,"output_tokens":2}
+	}`, withoutID(t, w.Body.Bytes()))
+}
+
+// withoutID returns a JSON object without its generated id.
+func withoutID(t *testing.T, body []byte) string {
+	t.Helper()
+	var fields map[string]json.RawMessage
+	require.NoError(t, json.Unmarshal(body, &fields))
+	delete(fields, "id")
+	out, _ := json.Marshal(fields)
+	return string(out)
+}
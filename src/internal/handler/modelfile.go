@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"ollama-api-proxy/src/internal/config"
+)
+
+// Width of the key column in the parameters block, as printed by Ollama.
+const parameterKeyWidth = 30
+
+// renderParameters formats parameters the way `ollama show --parameters`
+// does, one line per value with list values repeated.
+func renderParameters(parameters map[string]any) string {
+	var lines []string
+	for _, k := range slices.Sorted(maps.Keys(parameters)) {
+		switch v := parameters[k].(type) {
+		case []any:
+			for _, item := range v {
+				lines = append(lines, fmt.Sprintf("%-*s %s", parameterKeyWidth, k, formatParameter(item)))
+			}
+		default:
+			lines = append(lines, fmt.Sprintf("%-*s %s", parameterKeyWidth, k, formatParameter(v)))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatParameter prints strings quoted and numbers and booleans as is, like
+// Ollama. Anything else, such as a map, is printed as JSON.
+func formatParameter(v any) string {
+	switch v := v.(type) {
+	case string:
+		return strconv.Quote(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v)
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(out)
+}
+
+// renderModelfile synthesizes a Modelfile from the model configuration.
+func renderModelfile(name string, info *config.ModelInfo) string {
+	var b strings.Builder
+	b.WriteString("# Modelfile generated by \"ollama show\"\n")
+	b.WriteString("# To build a new Modelfile based on this, replace FROM with:\n")
+	fmt.Fprintf(&b, "# FROM %s\n\n", name)
+	fmt.Fprintf(&b, "FROM %s\n", name)
+
+	if template := info.GetTemplate(); template != "" {
+		fmt.Fprintf(&b, "TEMPLATE \"\"\"%s\"\"\"\n", template)
+	}
+	if system := info.GetSystem(); system != "" {
+		fmt.Fprintf(&b, "SYSTEM \"\"\"%s\"\"\"\n", system)
+	}
+
+	parameters := info.GetParameters()
+	for _, line := range strings.Split(renderParameters(parameters), "\n") {
+		if k, v, ok := strings.Cut(line, " "); ok {
+			fmt.Fprintf(&b, "PARAMETER %s %s\n", k, strings.TrimSpace(v))
+		}
+	}
+
+	if license := info.GetLicense(); license != "" {
+		fmt.Fprintf(&b, "LICENSE \"\"\"%s\"\"\"\n", license)
+	}
+	return b.String()
+}
+
+// ggufModelInfo returns the GGUF-style metadata keys for the declared
+// architecture.
+func ggufModelInfo(name string, info *config.ModelInfo) map[string]any {
+	arch := info.GetArchitecture()
+	result := map[string]any{
+		"general.architecture":   arch,
+		"general.basename":       name,
+		arch + ".context_length": info.GetContextLength(),
+	}
+	if count, ok := parseParameterCount(info.GetParameterSize()); ok {
+		result["general.parameter_count"] = count
+	}
+	return result
+}
+
+// parseParameterCount converts a label such as "8B" or "1.5T" to a count.
+func parseParameterCount(label string) (int64, bool) {
+	label = strings.TrimSpace(strings.ToUpper(label))
+	if label == "" {
+		return 0, false
+	}
+
+	multiplier := 1.0
+	switch label[len(label)-1] {
+	case 'K':
+		multiplier = 1e3
+	case 'M':
+		multiplier = 1e6
+	case 'B':
+		multiplier = 1e9
+	case 'T':
+		multiplier = 1e12
+	}
+	if multiplier != 1 {
+		label = label[:len(label)-1]
+	}
+
+	value, err := strconv.ParseFloat(label, 64)
+	if err != nil || value < 0 {
+		return 0, false
+	}
+	return int64(value * multiplier), true
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderParameters(t *testing.T) {
+	out := renderParameters(map[string]any{
+		"stop":        []any{"<|im_end|>", "<|endoftext|>"},
+		"temperature": 0.7,
+		"num_ctx":     8192,
+		"penalize_nl": false,
+		"logit_bias":  map[string]any{"50256": -100},
+		"grammar":     []any{[]any{"a", "b"}},
+	})
+	assert.Equal(t, []string{
+		`grammar                        ["a","b"]`,
+		`logit_bias                     {"50256":-100}`,
+		`num_ctx                        8192`,
+		`penalize_nl                    false`,
+		`stop                           "<|im_end|>"`,
+		`stop                           "<|endoftext|>"`,
+		`temperature                    0.7`,
+	}, strings.Split(out, "\n"))
+}
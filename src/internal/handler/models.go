@@ -1,14 +1,13 @@
 package handler
 
 import (
-	"encoding/json"
 	"fmt"
 	"log/slog"
 	"net/http"
-	"net/url"
-	"sync"
+	"strings"
 	"time"
 
+	"ollama-api-proxy/src/internal/catalog"
 	"ollama-api-proxy/src/internal/config"
 	"ollama-api-proxy/src/internal/dto"
 	"ollama-api-proxy/src/internal/dto/ollama"
@@ -18,67 +17,147 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-var (
-	cacheModels *ollama.ListResponse
-	cacheMutex  sync.Mutex
-)
+// tagsModel is a model of /api/tags. Missing is not part of the Ollama API:
+// the proxy sets it on configured models the upstream does not serve, when
+// missing_models is "show".
+type tagsModel struct {
+	ollama.ListModelResponse
+	Missing bool `json:"missing,omitempty"`
+}
+
+type tagsResponse struct {
+	Models []tagsModel `json:"models"`
+}
 
 func GetModels(state *state.State) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		baseUrl, err := url.Parse(state.Config.OpenAIBaseURL)
+		entries, err := catalogEntries(c, state)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Invalid base URL"})
+			slog.Error("Failed to fetch models", "error", err)
+			abortOllamaUpstream(c, err)
 			return
 		}
-		apiKey := state.Config.OpenAIAPIKey
 
-		destUrl := baseUrl.JoinPath("models").String()
-		slog.Info("Fetching models from OpenAI API", "url", destUrl)
+		var response tagsResponse
+		response.Models = make([]tagsModel, len(entries))
+		for i, entry := range entries {
+			response.Models[i] = tagsModel{
+				ListModelResponse: ollama.ListModelResponse{
+					Name:         entry.Name,
+					Model:        entry.Name,
+					ModifiedAt:   time.Unix(entry.Created, 0),
+					Size:         0,
+					Digest:       entry.Info.Digest(),
+					Capabilities: entry.Info.GetCapabilities(),
+					Details:      modelDetails(entry.Info),
+				},
+				Missing: entry.Missing,
+			}
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
 
-		request, _ := http.NewRequest("GET", destUrl, nil)
-		request.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
+// catalogEntries returns the visible models of the merged catalogue, as
+// listed by both the Ollama and the OpenAI API.
+func catalogEntries(c *gin.Context, state *state.State) ([]catalog.Entry, error) {
+	models, err := state.Catalog.Models(c.Request.Context())
+	if err != nil {
+		return nil, err
+	}
+	configured := state.Models()
+	entries := catalog.Merge(models, configured, state.Config().MissingModels == "show")
+	return state.Visibility().Apply(entries, configured), nil
+}
 
-		// Send the request and handle the Response
-		resp, err := state.HttpClient.Do(request)
+// ListOpenAIModels serves /v1/models from the same catalogue as /api/tags.
+func ListOpenAIModels(state *state.State) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		entries, err := catalogEntries(c, state)
 		if err != nil {
 			slog.Error("Failed to fetch models", "error", err)
-			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to fetch models"})
+			abortUpstream(c, err)
 			return
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			slog.Error("Failed to fetch models", "status", resp.Status)
-			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to fetch models"})
-			return
+		object := "list"
+		response := openai.ListModels{Object: &object, Data: make([]openai.Model, len(entries))}
+		for i, entry := range entries {
+			response.Data[i] = openAIModel(entry)
 		}
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// GetOpenAIModel serves /v1/models/{id}. The id may be any name or alias
+// the chat endpoint accepts.
+func GetOpenAIModel(state *state.State) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := strings.TrimPrefix(c.Param("id"), "/")
 
-		var modelsResponse openai.ListModels
-		if err := json.NewDecoder(resp.Body).Decode(&modelsResponse); err != nil {
-			slog.Error("Failed to decode models response", "error", err)
-			c.JSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to decode models response"})
+		entries, err := catalogEntries(c, state)
+		if err != nil {
+			slog.Error("Failed to fetch models", "error", err)
+			abortUpstream(c, err)
 			return
 		}
 
-		var response ollama.ListResponse
-		response.Models = make([]ollama.ListModelResponse, len(modelsResponse.Data))
-		for i, model := range modelsResponse.Data {
-			response.Models[i] = ollama.ListModelResponse{
-				Name:       model.Id,
-				Model:      model.Id,
-				ModifiedAt: time.Unix(model.Created, 0),
-				Size:       0,
-				Digest:     "",
+		_, name := resolveModel(state.Models(), id)
+		for _, entry := range entries {
+			if entry.Name == name {
+				c.JSON(http.StatusOK, openAIModel(entry))
+				return
 			}
 		}
+		c.JSON(http.StatusNotFound, openai.NewModelNotFoundError(id))
+	}
+}
 
-		func() {
-			cacheMutex.Lock()
-			defer cacheMutex.Unlock()
-			cacheModels = &response
-		}()
+func openAIModel(entry catalog.Entry) openai.Model {
+	return openai.Model{
+		Id:      entry.Name,
+		Object:  "model",
+		Created: entry.Created,
+		OwnedBy: entry.OwnedBy,
+	}
+}
 
-		c.JSON(http.StatusOK, response)
+// resolveModel returns the configuration of the requested model, if any, and
+// its canonical name: the configured name, or the normalized request name.
+func resolveModel(models *config.Models, requested string) (*config.ModelInfo, string) {
+	if models != nil {
+		if info, err := models.GetModel(requested); err == nil {
+			return info, info.Name
+		}
+	}
+	return nil, config.NormalizeName(requested)
+}
+
+func modelDetails(info *config.ModelInfo) ollama.ModelDetails {
+	details := ollama.ModelDetails{
+		Format:            "gguf",
+		Family:            info.GetFamily(),
+		ParameterSize:     info.GetParameterSize(),
+		QuantizationLevel: info.GetQuantizationLevel(),
+	}
+	if details.Family != "" {
+		details.Families = []string{details.Family}
+	}
+	return details
+}
+
+// RefreshModels forces a refresh of the cached upstream model list.
+func RefreshModels(state *state.State) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := state.Catalog.Refresh(c.Request.Context()); err != nil {
+			slog.Error("Failed to refresh models", "error", err)
+			c.JSON(http.StatusBadGateway, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		models, _ := state.Catalog.Models(c.Request.Context())
+		c.JSON(http.StatusOK, gin.H{"models": len(models)})
 	}
 }
 
@@ -91,15 +170,22 @@ func GetModel(state *state.State) gin.HandlerFunc {
 			return
 		}
 
+		if req.Model == "" {
+			req.Model = req.Name
+		}
+
 		if req.Model == "" {
 			slog.Warn("Model not found", "model", req.Model)
 			c.JSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Model name is required"})
 			return
 		}
 
-		var modelInfo *config.ModelInfo
-		if state.Models != nil {
-			modelInfo, _ = state.Models.GetModel(req.Model)
+		models := state.Models()
+		modelInfo, modelName := resolveModel(models, req.Model)
+		if !state.Visibility().Visible(modelName, models) {
+			slog.Warn("Model is hidden", "model", req.Model)
+			c.JSON(http.StatusNotFound, dto.ErrorResponse{Error: fmt.Sprintf("model '%s' not found", req.Model)})
+			return
 		}
 
 		if modelInfo == nil {
@@ -108,19 +194,14 @@ func GetModel(state *state.State) gin.HandlerFunc {
 		}
 
 		c.JSON(http.StatusOK, ollama.ShowResponse{
-			License:    "",
-			Modelfile:  "",
-			Parameters: "",
-			Template:   "",
-			System:     "",
-			Details:    ollama.ModelDetails{
-				Format: "gguf",
-			},
-			Messages:   []ollama.Message{},
-			ModelInfo: map[string]any{
-				"general.architecture": "llama",
-				"llama.context_length": modelInfo.GetContextLength(),
-			},
+			License:       modelInfo.GetLicense(),
+			Modelfile:     renderModelfile(req.Model, modelInfo),
+			Parameters:    renderParameters(modelInfo.GetParameters()),
+			Template:      modelInfo.GetTemplate(),
+			System:        modelInfo.GetSystem(),
+			Details:       modelDetails(modelInfo),
+			Messages:      []ollama.Message{},
+			ModelInfo:     ggufModelInfo(req.Model, modelInfo),
 			ProjectorInfo: nil,
 			Tensors:       []ollama.Tensor{},
 			Capabilities:  modelInfo.GetCapabilities(),
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"ollama-api-proxy/src/internal/capture"
+	"ollama-api-proxy/src/internal/dto"
+	"ollama-api-proxy/src/internal/dto/ollama"
+	"ollama-api-proxy/src/internal/state"
+	"ollama-api-proxy/src/internal/stream"
+	"ollama-api-proxy/src/internal/telemetry"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// OllamaChat serves the Ollama chat API by translating requests to chat
+// completions for the configured upstream, and the replies back to Ollama
+// chat responses, streamed as NDJSON by default.
+func OllamaChat(appState *state.State) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ollama.ChatRequest
+		if err := c.ShouldBindJSON(&req); errors.Is(err, io.EOF) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, dto.ErrorResponse{Error: "Request body is empty"})
+			return
+		} else if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		cfg := appState.Config()
+		models := appState.Models()
+
+		requestedModel := req.Model
+		modelInfo, modelName := resolveModel(models, req.Model)
+		if !appState.Visibility().Visible(modelName, models) {
+			c.AbortWithStatusJSON(http.StatusNotFound, dto.ErrorResponse{Error: fmt.Sprintf("model '%s' not found", req.Model)})
+			return
+		}
+		defer withDeadline(c, cfg, modelInfo)()
+
+		chatReq, err := translateOllamaRequest(&req)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, dto.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		baseUrl, err := url.Parse(cfg.OpenAIBaseURL)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Invalid base URL"})
+			return
+		}
+		tagRequest(c, req.Model, baseUrl.Host, chatReq.Stream)
+
+		var captureFlag *bool
+		if modelInfo != nil {
+			captureFlag = modelInfo.GetCapture()
+		}
+		payload, err := preparePayload(c, appState, chatReq, modelInfo, modelName)
+		if err != nil {
+			var contextErr *contextError
+			if errors.As(err, &contextErr) {
+				c.AbortWithStatusJSON(http.StatusBadRequest, dto.ErrorResponse{Error: contextErr.Error()})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to marshal request payload"})
+			return
+		}
+
+		httpRequest, err := newUpstreamRequest(c, cfg, baseUrl.JoinPath("/chat/completions"), payload, chatReq.Stream)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, dto.ErrorResponse{Error: "Failed to create HTTP request"})
+			return
+		}
+
+		httpResponse, err := sendUpstream(c, appState, httpRequest, chatReq.Stream)
+		if err != nil {
+			abortOllamaUpstream(c, err)
+			return
+		}
+		defer httpResponse.Body.Close()
+
+		if httpResponse.StatusCode != http.StatusOK {
+			abortOllamaUpstream(c, captureUpstreamError(c, appState, captureFlag, chatReq, payload, httpResponse))
+			return
+		}
+
+		encoder := stream.NewOllamaEncoder(c.Writer, requestedModel, chatReq.Stream)
+		encoder.Thinking = req.Think == nil || *req.Think
+
+		if !chatReq.Stream {
+			body, err := io.ReadAll(httpResponse.Body)
+			if err != nil {
+				abortOllamaUpstream(c, err)
+				return
+			}
+			if appState.Capture.ShouldCapture(captureFlag) {
+				writeCapture(c, appState.Capture, chatReq, payload, httpResponse.StatusCode, body)
+			}
+
+			events, err := stream.DecodeOpenAICompletion(body)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadGateway, dto.ErrorResponse{Error: "Invalid response from upstream API"})
+				return
+			}
+			recordEventUsage(c, trace.SpanFromContext(c.Request.Context()), events)
+			c.Writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			encoder.Encode(events)
+			encoder.Close()
+			return
+		}
+
+		c.Writer.Header().Set("Content-Type", "application/x-ndjson")
+
+		_, span := telemetry.Tracer().Start(c.Request.Context(), "ollama.chat.stream", trace.WithAttributes(
+			telemetry.AttrModel.String(chatReq.Model),
+		))
+		defer span.End()
+
+		var assembler *capture.StreamAssembler
+		if appState.Capture.ShouldCapture(captureFlag) {
+			assembler = &capture.StreamAssembler{}
+			defer func() {
+				writeCapture(c, appState.Capture, chatReq, payload, httpResponse.StatusCode, assembler.Message())
+			}()
+		}
+
+		decoder := stream.NewOpenAIDecoder(httpResponse.Body)
+		if assembler != nil {
+			decoder.OnData = assembler.Add
+		}
+		if err := relay(c, span, decoder, encoder); err != nil {
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"ollama-api-proxy/src/internal/dto/newapi"
+	"ollama-api-proxy/src/internal/dto/ollama"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslateOllamaRequest(t *testing.T) {
+	var req ollama.ChatRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"model": "gpt-4.1",
+		"format": "json",
+		"options": {"temperature": 0.2, "top_p": 0.9, "num_predict": 64, "num_ctx": 4096, "stop": ["END"]},
+		"messages": [
+			{"role": "user", "content": "weather?", "images": ["iVBORw0KGgo="]},
+			{"role": "assistant", "tool_calls": [
+				{"function": {"name": "weather", "arguments": {"city": "Oslo"}}},
+				{"function": {"name": "weather", "arguments": {"city": "Rome"}}}
+			]},
+			{"role": "tool", "content": "cold"},
+			{"role": "tool", "content": "warm"}
+		],
+		"tools": [{"type": "function", "function": {"name": "weather", "description": "Current weather"}}]
+	}`), &req))
+
+	chatReq, err := translateOllamaRequest(&req)
+	require.NoError(t, err)
+	assert.True(t, chatReq.Stream, "Ollama streams by default")
+	require.NotNil(t, chatReq.StreamOptions)
+	assert.True(t, chatReq.StreamOptions.IncludeUsage)
+	require.NotNil(t, chatReq.Temperature)
+	assert.Equal(t, 0.2, *chatReq.Temperature)
+	assert.EqualValues(t, 64, chatReq.MaxTokens)
+	assert.JSONEq(t, `{"temperature":0.2,"top_p":0.9,"num_predict":64,"num_ctx":4096,"stop":["END"]}`, string(chatReq.Options),
+		"The raw options should be kept for the proxy")
+	require.NotNil(t, chatReq.ResponseFormat)
+	assert.Equal(t, "json_object", chatReq.ResponseFormat.Type)
+
+	require.Len(t, chatReq.Messages, 4)
+	content := chatReq.Messages[0].ParseContent()
+	require.Len(t, content, 2)
+	assert.Equal(t, "weather?", content[0].Text)
+	assert.Equal(t, "data:image/png;base64,iVBORw0KGgo=", content[1].GetImageMedia().Url, "Images should be sent as data URLs")
+
+	calls := chatReq.Messages[1].ParseToolCalls()
+	require.Len(t, calls, 2)
+	assert.JSONEq(t, `{"city":"Oslo"}`, calls[0].Function.Arguments)
+	assert.Equal(t, calls[0].ID, chatReq.Messages[2].ToolCallId, "Tool results should be matched to the calls in order")
+	assert.Equal(t, calls[1].ID, chatReq.Messages[3].ToolCallId)
+
+	require.Len(t, chatReq.Tools, 1)
+	assert.Equal(t, "weather", chatReq.Tools[0].Function.Name)
+	assert.Nil(t, chatReq.Tools[0].Function.Parameters, "Empty parameters should be left out")
+}
+
+func TestTranslateOllamaRequestFormat(t *testing.T) {
+	stream := false
+	req := &ollama.ChatRequest{Model: "gpt-4.1", Stream: &stream, Format: json.RawMessage(`{"type":"object"}`)}
+	chatReq, err := translateOllamaRequest(req)
+	require.NoError(t, err)
+	assert.False(t, chatReq.Stream)
+	assert.Nil(t, chatReq.StreamOptions)
+	require.NotNil(t, chatReq.ResponseFormat)
+	assert.Equal(t, "json_schema", chatReq.ResponseFormat.Type)
+	assert.JSONEq(t, `{"type":"object"}`, string(chatReq.ResponseFormat.JsonSchema.Schema.(json.RawMessage)))
+
+	req.Format = json.RawMessage(`"yaml"`)
+	_, err = translateOllamaRequest(req)
+	assert.EqualError(t, err, "format 'yaml' is not supported")
+}
+
+func TestOllamaChat(t *testing.T) {
+	requests := make(chan newapi.GeneralOpenAIRequest, 1)
+	handler := OllamaChat(testState(t, "", chatUpstream(t, "Hello", requests)))
+
+	w := serve(handler, `{"model":"gpt-4.1:latest","stream":false,"messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"user: hi"}, messageContents((<-requests).Messages))
+	var resp ollama.ChatResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "gpt-4.1:latest", resp.Model, "The requested model name should be echoed")
+	assert.Equal(t, ollama.Message{Role: "assistant", Content: "Hello"}, resp.Message)
+	assert.True(t, resp.Done)
+	assert.Equal(t, "stop", resp.DoneReason)
+	assert.Equal(t, 5, resp.PromptEvalCount)
+	assert.Equal(t, 2, resp.EvalCount)
+}
+
+func TestOllamaChatStream(t *testing.T) {
+	requests := make(chan newapi.GeneralOpenAIRequest, 1)
+	handler := OllamaChat(testState(t, "", chatUpstream(t, "Hello", requests)))
+
+	w := serve(handler, `{"model":"gpt-4.1","messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.True(t, (<-requests).Stream)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+	var content strings.Builder
+	var last ollama.ChatResponse
+	for line := range strings.SplitSeq(strings.TrimSpace(w.Body.String()), "\n") {
+		var resp ollama.ChatResponse
+		require.NoError(t, json.Unmarshal([]byte(line), &resp), line)
+		assert.Equal(t, "gpt-4.1", resp.Model)
+		content.WriteString(resp.Message.Content)
+		last = resp
+	}
+	assert.Equal(t, "Hello", content.String())
+	assert.True(t, last.Done, "The final line should finish the stream")
+	assert.Equal(t, "stop", last.DoneReason)
+	assert.Equal(t, 5, last.PromptEvalCount)
+	assert.Equal(t, 2, last.EvalCount)
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"ollama-api-proxy/src/internal/dto/newapi"
+	"ollama-api-proxy/src/internal/dto/ollama"
+)
+
+// translateOllamaRequest maps an Ollama chat request to a chat completion
+// request. Options without an OpenAI counterpart are kept in Options for
+// the proxy itself, e.g. num_ctx.
+func translateOllamaRequest(req *ollama.ChatRequest) (*newapi.GeneralOpenAIRequest, error) {
+	chatReq := &newapi.GeneralOpenAIRequest{
+		Model:  req.Model,
+		Stream: req.Stream == nil || *req.Stream,
+	}
+	if chatReq.Stream {
+		chatReq.StreamOptions = &newapi.StreamOptions{IncludeUsage: true}
+	}
+
+	if len(req.Options) > 0 {
+		raw, err := json.Marshal(req.Options)
+		if err != nil {
+			return nil, fmt.Errorf("options: %w", err)
+		}
+		var options ollamaOptions
+		if err := json.Unmarshal(raw, &options); err != nil {
+			return nil, fmt.Errorf("options: %w", err)
+		}
+		chatReq.Temperature = options.Temperature
+		chatReq.TopP = options.TopP
+		chatReq.TopK = options.TopK
+		chatReq.Seed = options.Seed
+		chatReq.PresencePenalty = options.PresencePenalty
+		chatReq.FrequencyPenalty = options.FrequencyPenalty
+		if options.NumPredict > 0 {
+			chatReq.MaxTokens = uint(options.NumPredict)
+		}
+		if len(options.Stop) > 0 {
+			chatReq.Stop = options.Stop
+		}
+		chatReq.Options = raw
+	}
+
+	if isSet(req.Format) {
+		var format string
+		if err := json.Unmarshal(req.Format, &format); err == nil {
+			if format != "json" {
+				return nil, fmt.Errorf("format '%s' is not supported", format)
+			}
+			chatReq.ResponseFormat = &newapi.ResponseFormat{Type: "json_object"}
+		} else {
+			chatReq.ResponseFormat = &newapi.ResponseFormat{
+				Type:       "json_schema",
+				JsonSchema: &newapi.FormatJsonSchema{Name: "response", Schema: req.Format},
+			}
+		}
+	}
+
+	// Ollama tool results do not reference their call, so they are matched
+	// to the calls in order.
+	var pending []string
+	for i, message := range req.Messages {
+		out := newapi.Message{Role: message.Role}
+		switch message.Role {
+		case "assistant":
+			var calls []newapi.ToolCallRequest
+			for _, call := range message.ToolCalls {
+				id := "call_" + newItemID()
+				pending = append(pending, id)
+				arguments, err := json.Marshal(call.Function.Arguments)
+				if err != nil {
+					return nil, fmt.Errorf("messages[%d]: %w", i, err)
+				}
+				calls = append(calls, newapi.ToolCallRequest{
+					ID:       id,
+					Type:     "function",
+					Function: newapi.FunctionRequest{Name: call.Function.Name, Arguments: string(arguments)},
+				})
+			}
+			if len(calls) > 0 {
+				out.SetToolCalls(calls)
+			}
+		case "tool":
+			if len(pending) > 0 {
+				out.ToolCallId = pending[0]
+				pending = pending[1:]
+			}
+		}
+
+		if len(message.Images) == 0 {
+			out.SetStringContent(message.Content)
+		} else {
+			content := []newapi.MediaContent{{Type: newapi.ContentTypeText, Text: message.Content}}
+			for _, image := range message.Images {
+				url := "data:" + http.DetectContentType(image) + ";base64," + base64.StdEncoding.EncodeToString(image)
+				content = append(content, newapi.MediaContent{
+					Type:     newapi.ContentTypeImageURL,
+					ImageUrl: map[string]string{"url": url},
+				})
+			}
+			out.SetMediaContent(content)
+		}
+		chatReq.Messages = append(chatReq.Messages, out)
+	}
+
+	for _, tool := range req.Tools {
+		function := newapi.FunctionRequest{Name: tool.Function.Name, Description: tool.Function.Description}
+		if tool.Function.Parameters.Type != "" {
+			function.Parameters = tool.Function.Parameters
+		}
+		chatReq.Tools = append(chatReq.Tools, newapi.ToolCallRequest{Type: "function", Function: function})
+	}
+
+	return chatReq, nil
+}
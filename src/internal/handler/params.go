@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"ollama-api-proxy/src/internal/config"
+)
+
+// Fields that set the same limit; a default for one is skipped when the
+// client sent the other.
+var alternativeFields = map[string]string{
+	"max_tokens":            "max_completion_tokens",
+	"max_completion_tokens": "max_tokens",
+}
+
+// integerFields are the OpenAI and Ollama fields upstreams parse as
+// integers; clamped values for them are rounded into the range.
+var integerFields = map[string]bool{
+	"max_tokens":            true,
+	"max_completion_tokens": true,
+	"n":                     true,
+	"seed":                  true,
+	"top_k":                 true,
+	"top_logprobs":          true,
+	"num_ctx":               true,
+	"num_predict":           true,
+}
+
+// applyParameters applies the model's defaults to the fields missing from
+// payload and its overrides to every request. Keys that are not part of the
+// OpenAI request are sent as-is, so vendor-specific fields can be set too.
+func applyParameters(payload []byte, info *config.ModelInfo) ([]byte, error) {
+	defaults := info.GetDefaults()
+	overrides := info.GetOverrides()
+	compat := info.GetCompat()
+	if len(defaults) == 0 && len(overrides) == 0 && compat == nil {
+		return payload, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, err
+	}
+
+	present := func(key string) bool {
+		value, ok := fields[key]
+		return ok && string(value) != "null"
+	}
+	for key, value := range defaults {
+		if present(key) || present(alternativeFields[key]) {
+			continue
+		}
+		if err := setField(fields, key, value); err != nil {
+			return nil, err
+		}
+	}
+	for key, value := range overrides {
+		if value == nil {
+			delete(fields, key)
+			continue
+		}
+		if err := setField(fields, key, value); err != nil {
+			return nil, err
+		}
+	}
+
+	if compat != nil {
+		applyCompat(fields, compat)
+	}
+
+	return json.Marshal(fields)
+}
+
+// applyCompat renames, drops and clamps fields for models that reject some
+// OpenAI parameters.
+func applyCompat(fields map[string]json.RawMessage, compat *config.Compat) {
+	for from, to := range compat.Rename {
+		value, ok := fields[from]
+		if !ok {
+			continue
+		}
+		delete(fields, from)
+		if _, exists := fields[to]; !exists {
+			fields[to] = value
+		}
+	}
+
+	for _, key := range compat.Drop {
+		delete(fields, key)
+	}
+
+	for key, limit := range compat.Clamp {
+		var value float64
+		if err := json.Unmarshal(fields[key], &value); err != nil {
+			continue
+		}
+		clamped := value
+		if limit.Min != nil {
+			clamped = max(clamped, *limit.Min)
+			if integerFields[key] {
+				clamped = math.Ceil(clamped)
+			}
+		}
+		if limit.Max != nil {
+			clamped = min(clamped, *limit.Max)
+			if integerFields[key] {
+				clamped = math.Floor(clamped)
+			}
+		}
+		if clamped != value {
+			fields[key], _ = json.Marshal(clamped)
+		}
+	}
+}
+
+func setField(fields map[string]json.RawMessage, key string, value any) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("invalid value for '%s': %w", key, err)
+	}
+	fields[key] = raw
+	return nil
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"encoding/json"
+	"testing"
+
+	"ollama-api-proxy/src/internal/dto/newapi"
+	"ollama-api-proxy/src/internal/state"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyParametersClamp(t *testing.T) {
+	models := testModels(t, `
+models:
+  - name: "gpt-4.1"
+    config:
+      compat:
+        clamp:
+          max_tokens: {min: 16.5, max: 4000.5}
+          temperature: {max: 1.5}
+`)
+	info := testModel(t, models, "gpt-4.1")
+
+	tests := []struct {
+		payload string
+		want    string
+	}{
+		{`{"max_tokens":8000,"temperature":2}`, `{"max_tokens":4000,"temperature":1.5}`},
+		{`{"max_tokens":1}`, `{"max_tokens":17}`},
+		{`{"max_tokens":100,"temperature":0.7}`, `{"max_tokens":100,"temperature":0.7}`},
+	}
+	for _, tt := range tests {
+		out, err := applyParameters([]byte(tt.payload), info)
+		require.NoError(t, err)
+		assert.JSONEq(t, tt.want, string(out), tt.payload)
+	}
+}
+
+func TestPreparePayloadParameters(t *testing.T) {
+	models := testModels(t, `
+models:
+  - name: "gpt-4.1"
+    config:
+      defaults:
+        temperature: 0
+        repetition_penalty: 1.1
+      overrides:
+        n: 1
+`)
+	req := &newapi.GeneralOpenAIRequest{
+		Model:    "gpt-4.1",
+		Messages: []newapi.Message{{Role: "user", Content: json.RawMessage(`"hi"`)}},
+		N:        3,
+	}
+	c, _ := testContext()
+	payload, err := preparePayload(c, &state.State{Tokenizer: testTokenizer()}, req, testModel(t, models, "gpt-4.1"), "gpt-4.1")
+	require.NoError(t, err)
+
+	var fields map[string]any
+	require.NoError(t, json.Unmarshal(payload, &fields))
+	assert.Equal(t, 1.1, fields["repetition_penalty"], "Vendor fields should be sent upstream")
+	require.NotNil(t, req.Temperature)
+	assert.Zero(t, *req.Temperature)
+	assert.Equal(t, 1, req.N)
+	assert.True(t, isDeterministic(req), "Parameters should make the request cacheable")
+}
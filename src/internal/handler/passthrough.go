@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+
+	"ollama-api-proxy/src/internal/dto/openai"
+	"ollama-api-proxy/src/internal/state"
+
+	"github.com/gin-gonic/gin"
+)
+
+// passthrough forwards a request body to an upstream endpoint with the
+// upstream model name and relays successful replies as-is, for APIs the
+// upstream implements itself. Replies carry the model name of the request,
+// and fail writes the final event of a stream that breaks off.
+func passthrough(c *gin.Context, appState *state.State, endpoint *url.URL, body []byte, model, upstreamModel string, stream bool, fail func(w io.Writer, err error) error) {
+	if upstreamModel != model {
+		body = replaceModel(body, upstreamModel)
+	}
+	httpRequest, err := newUpstreamRequest(c, appState.Config(), endpoint, body, stream)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, "Failed to create HTTP request"))
+		return
+	}
+
+	httpResponse, err := sendUpstream(c, appState, httpRequest, stream)
+	if err != nil {
+		abortUpstream(c, err)
+		return
+	}
+	defer httpResponse.Body.Close()
+
+	if httpResponse.StatusCode != http.StatusOK {
+		abortUpstream(c, readUpstreamError(httpResponse))
+		return
+	}
+
+	contentType := httpResponse.Header.Get("Content-Type")
+	if !stream {
+		respBody, err := io.ReadAll(httpResponse.Body)
+		if err != nil {
+			abortUpstream(c, err)
+			return
+		}
+		if upstreamModel != model {
+			respBody = replaceModel(respBody, model)
+		}
+		c.Data(httpResponse.StatusCode, contentType, respBody)
+		return
+	}
+
+	c.Writer.Header().Set("Content-Type", "text/event-stream")
+	c.Writer.Header().Set("Cache-Control", "no-cache")
+	c.Writer.Header().Set("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+
+	reader := bufio.NewReader(httpResponse.Body)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			// A partial line is dropped so the error event stands alone.
+			if ctxErr := c.Request.Context().Err(); ctxErr != nil {
+				err = ctxErr
+			}
+			markAborted(c, err)
+			if !errors.Is(err, context.Canceled) {
+				fail(c.Writer, err)
+				c.Writer.Flush()
+			}
+			return
+		}
+		if upstreamModel != model {
+			line = replaceEventModel(line, model)
+		}
+		if _, err := c.Writer.Write(line); err != nil {
+			markAborted(c, err)
+			return
+		}
+		if err == io.EOF {
+			c.Writer.Flush()
+			return
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			c.Writer.Flush()
+		}
+	}
+}
+
+// replaceEventModel sets the model of an SSE data line, at the top level as
+// in completion chunks and in the response of Responses API events.
+func replaceEventModel(line []byte, model string) []byte {
+	data, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok {
+		return line
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return line
+	}
+	if _, ok := fields["model"]; ok {
+		fields["model"], _ = json.Marshal(model)
+	}
+	if response, ok := fields["response"]; ok {
+		fields["response"] = replaceModel(response, model)
+	}
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return line
+	}
+	return append(append([]byte("data: "), out...), '\n')
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// brokenUpstream streams events and then stalls until the proxy gives up.
+func brokenUpstream(events ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			io.WriteString(w, event+"\n\n")
+		}
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}
+}
+
+func TestCompletionsPassthroughStream(t *testing.T) {
+	appState := testState(t, completionModels, brokenUpstream(
+		`data: {"object":"text_completion","model":"gpt-3.5-turbo-instruct","choices":[{"index":0,"text":"x"}]}`,
+	))
+	appState.Config().IdleTimeout = 50 * time.Millisecond
+
+	w := serve(Completions(appState), `{"model":"legacy","prompt":"a","stream":true}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	events := strings.Split(strings.TrimSpace(w.Body.String()), "\n\n")
+	require.Len(t, events, 2)
+	assert.Contains(t, events[0], `"model":"legacy"`, "Chunks should carry the requested model")
+	assert.JSONEq(t, `{"error":{"message":"Upstream API stopped sending data","type":"server_error","param":null,"code":null}}`,
+		strings.TrimPrefix(events[1], "data: "), "A broken stream should end with an error")
+}
+
+func TestResponsesPassthroughStream(t *testing.T) {
+	appState := testState(t, `
+models:
+  - name: "fast"
+    upstream_name: "gpt-4.1"
+    config:
+      responses_api: "passthrough"
+`, brokenUpstream(
+		"event: response.created\ndata: {\"type\":\"response.created\",\"response\":{\"id\":\"resp_1\",\"model\":\"gpt-4.1\"}}",
+	))
+	appState.Config().IdleTimeout = 50 * time.Millisecond
+
+	w := serve(Responses(appState), `{"model":"fast","input":"hi","stream":true}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	names, data := sseEvents(t, w.Body.String())
+	assert.Equal(t, []string{"response.created", "error"}, names)
+	assert.Equal(t, "fast", data[0]["response"].(map[string]any)["model"])
+	assert.Equal(t, "Upstream API stopped sending data", data[1]["message"])
+}
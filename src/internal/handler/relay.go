@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"ollama-api-proxy/src/internal/stream"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// relay feeds the events of an upstream stream to enc, flushing after every
+// chunk. The encoder is closed when the stream ends normally, and failed with
+// the error frame of its format otherwise, unless the client went away.
+func relay(c *gin.Context, span trace.Span, dec stream.Decoder, enc stream.Encoder) error {
+	for {
+		events, err := dec.Next()
+		if err == io.EOF {
+			return enc.Close()
+		}
+		if err != nil {
+			if ctxErr := c.Request.Context().Err(); ctxErr != nil {
+				err = ctxErr
+			}
+			markAborted(c, err)
+			if !errors.Is(err, context.Canceled) {
+				enc.Fail(err)
+			}
+			return err
+		}
+		recordEventUsage(c, span, events)
+		if err := enc.Encode(events); err != nil {
+			markAborted(c, err)
+			return err
+		}
+		c.Writer.Flush()
+	}
+}
+
+// recordEventUsage records the usage reported among events.
+func recordEventUsage(c *gin.Context, span trace.Span, events []stream.Event) {
+	for _, event := range events {
+		if event.Type == stream.Usage {
+			recordUsage(c, span, event.Usage)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"ollama-api-proxy/src/internal/middleware"
+	"ollama-api-proxy/src/internal/stream"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func testContext() (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	return c, w
+}
+
+func TestRelay(t *testing.T) {
+	upstream := `data: {"choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":"stop"}]}
+
+data: {"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}
+
+data: [DONE]
+
+`
+	c, w := testContext()
+	err := relay(c, trace.SpanFromContext(c.Request.Context()),
+		stream.NewOpenAIDecoder(strings.NewReader(upstream)), stream.NewOllamaEncoder(c.Writer, "o3", true))
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.Contains(t, lines[1], `"done":true`)
+	assert.Equal(t, 5, c.GetInt(middleware.KeyPromptTokens), "Usage should be recorded for the access log")
+	assert.Equal(t, 2, c.GetInt(middleware.KeyCompletionTokens))
+}
+
+func TestRelayUpstreamError(t *testing.T) {
+	upstream := `data: {"choices":[{"index":0,"delta":{"content":"Hel"},"finish_reason":null}]}
+
+data: {"error":{"message":"model overloaded","type":"server_error","code":null,"param":null}}
+
+`
+	c, w := testContext()
+	err := relay(c, trace.SpanFromContext(c.Request.Context()),
+		stream.NewOpenAIDecoder(strings.NewReader(upstream)), stream.NewOpenAIEncoder(c.Writer, "o3", false))
+	assert.Error(t, err)
+	assert.Contains(t, w.Body.String(), `"message":"model overloaded"`)
+	assert.NotContains(t, w.Body.String(), "[DONE]")
+	_, aborted := c.Get(middleware.KeyAborted)
+	assert.False(t, aborted, "Upstream errors are not aborts")
+}
+
+func TestRelayOpenAIPassthrough(t *testing.T) {
+	upstream := `data: {"id":"chatcmpl-up1","object":"chat.completion.chunk","model":"gpt-4.1-2025-04-14","system_fingerprint":"fp_1","choices":[{"index":0,"delta":{"role":"assistant","content":""},"logprobs":null,"finish_reason":null}],"usage":null}
+
+data: {"id":"chatcmpl-up1","object":"chat.completion.chunk","model":"gpt-4.1-2025-04-14","system_fingerprint":"fp_1","choices":[{"index":0,"delta":{"content":"Hi"},"logprobs":{"content":[{"token":"Hi","logprob":-0.1}]},"finish_reason":"stop"}],"usage":null}
+
+data: {"id":"chatcmpl-up1","object":"chat.completion.chunk","model":"gpt-4.1-2025-04-14","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":1,"total_tokens":6}}
+
+data: [DONE]
+
+`
+	c, w := testContext()
+	decoder := stream.NewOpenAIDecoder(strings.NewReader(upstream))
+	decoder.KeepRaw = true
+	err := relay(c, trace.SpanFromContext(c.Request.Context()), decoder, stream.NewOpenAIEncoder(c.Writer, "gpt", false))
+	require.NoError(t, err)
+
+	events := strings.Split(strings.TrimSpace(w.Body.String()), "\n\n")
+	require.Len(t, events, 3, "The usage chunk should be dropped without include_usage")
+	assert.JSONEq(t, `{"id":"chatcmpl-up1","object":"chat.completion.chunk","model":"gpt","system_fingerprint":"fp_1","choices":[{"index":0,"delta":{"role":"assistant","content":""},"logprobs":null,"finish_reason":null}]}`,
+		strings.TrimPrefix(events[0], "data: "), "Chunks without content should be passed on too")
+	assert.JSONEq(t, `{"id":"chatcmpl-up1","object":"chat.completion.chunk","model":"gpt","system_fingerprint":"fp_1","choices":[{"index":0,"delta":{"content":"Hi"},"logprobs":{"content":[{"token":"Hi","logprob":-0.1}]},"finish_reason":"stop"}]}`,
+		strings.TrimPrefix(events[1], "data: "), "The upstream id and logprobs should survive")
+	assert.Equal(t, "data: [DONE]", events[2])
+	assert.Equal(t, 5, c.GetInt(middleware.KeyPromptTokens), "Usage should still be recorded")
+}
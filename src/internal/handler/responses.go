@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"ollama-api-proxy/src/internal/capture"
+	"ollama-api-proxy/src/internal/conversation"
+	"ollama-api-proxy/src/internal/dto/newapi"
+	"ollama-api-proxy/src/internal/dto/openai"
+	"ollama-api-proxy/src/internal/state"
+	"ollama-api-proxy/src/internal/stream"
+	"ollama-api-proxy/src/internal/telemetry"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Responses serves the OpenAI Responses API. Models configured with
+// responses_api "passthrough" are forwarded to the upstream /responses
+// endpoint; all others are translated to chat completions, with
+// previous_response_id backed by the local conversation store.
+func Responses(appState *state.State) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := c.GetRawData()
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+		if len(bytes.TrimSpace(body)) == 0 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, "Request body is empty"))
+			return
+		}
+		var req newapi.OpenAIResponsesRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		cfg := appState.Config()
+		models := appState.Models()
+
+		modelInfo, modelName := resolveModel(models, req.Model)
+		if !appState.Visibility().Visible(modelName, models) {
+			c.AbortWithStatusJSON(http.StatusNotFound, openai.NewError(http.StatusNotFound, fmt.Sprintf("model '%s' not found", req.Model)))
+			return
+		}
+		defer withDeadline(c, cfg, modelInfo)()
+
+		baseUrl, err := url.Parse(cfg.OpenAIBaseURL)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, "Invalid base URL"))
+			return
+		}
+		tagRequest(c, req.Model, baseUrl.Host, req.Stream)
+
+		if modelInfo != nil && modelInfo.GetResponsesAPI() == "passthrough" {
+			passthrough(c, appState, baseUrl.JoinPath("/responses"), body, req.Model, modelInfo.GetUpstreamName(), req.Stream, writeResponsesError)
+			return
+		}
+
+		var history []newapi.Message
+		if req.PreviousResponseID != "" {
+			previous, ok := appState.Conversations.Get(req.PreviousResponseID)
+			if !ok {
+				c.AbortWithStatusJSON(http.StatusNotFound, openai.NewPreviousResponseNotFoundError(req.PreviousResponseID))
+				return
+			}
+			history = previous.Messages
+		}
+
+		chatReq, messages, err := translateResponsesRequest(&req, history)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, openai.NewError(http.StatusBadRequest, err.Error()))
+			return
+		}
+
+		var captureFlag *bool
+		if modelInfo != nil {
+			captureFlag = modelInfo.GetCapture()
+		}
+		payload, err := preparePayload(c, appState, chatReq, modelInfo, modelName)
+		if err != nil {
+			abortPrepare(c, err)
+			return
+		}
+
+		httpRequest, err := newUpstreamRequest(c, cfg, baseUrl.JoinPath("/chat/completions"), payload, req.Stream)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, openai.NewError(http.StatusInternalServerError, "Failed to create HTTP request"))
+			return
+		}
+
+		httpResponse, err := sendUpstream(c, appState, httpRequest, req.Stream)
+		if err != nil {
+			abortUpstream(c, err)
+			return
+		}
+		defer httpResponse.Body.Close()
+
+		if httpResponse.StatusCode != http.StatusOK {
+			abortUpstream(c, captureUpstreamError(c, appState, captureFlag, chatReq, payload, httpResponse))
+			return
+		}
+
+		store := func(builder *responseBuilder) {
+			if !builder.resp.Store || builder.resp.Status == "failed" {
+				return
+			}
+			appState.Conversations.Set(builder.resp.Id, &conversation.Conversation{
+				Messages: append(messages, builder.assistantMessage()),
+				Created:  time.Now(),
+			})
+		}
+
+		if !req.Stream {
+			body, err := io.ReadAll(httpResponse.Body)
+			if err != nil {
+				abortUpstream(c, err)
+				return
+			}
+			if appState.Capture.ShouldCapture(captureFlag) {
+				writeCapture(c, appState.Capture, chatReq, payload, httpResponse.StatusCode, body)
+			}
+
+			events, err := stream.DecodeOpenAICompletion(body)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadGateway, openai.NewError(http.StatusBadGateway, "Invalid response from OpenAI API"))
+				return
+			}
+			recordEventUsage(c, trace.SpanFromContext(c.Request.Context()), events)
+
+			builder := newResponseBuilder(&req, nil)
+			builder.Encode(events)
+			builder.Close()
+			store(builder)
+			c.JSON(http.StatusOK, builder.resp)
+			return
+		}
+
+		c.Writer.Header().Set("Content-Type", "text/event-stream")
+		c.Writer.Header().Set("Cache-Control", "no-cache")
+		c.Writer.Header().Set("Connection", "keep-alive")
+
+		_, span := telemetry.Tracer().Start(c.Request.Context(), "responses.stream", trace.WithAttributes(
+			telemetry.AttrModel.String(chatReq.Model),
+		))
+		defer span.End()
+
+		var assembler *capture.StreamAssembler
+		if appState.Capture.ShouldCapture(captureFlag) {
+			assembler = &capture.StreamAssembler{}
+			defer func() {
+				writeCapture(c, appState.Capture, chatReq, payload, httpResponse.StatusCode, assembler.Message())
+			}()
+		}
+
+		builder := newResponseBuilder(&req, func(event string, data gin.H) {
+			c.SSEvent(event, data)
+			c.Writer.Flush()
+		})
+		builder.start()
+
+		decoder := stream.NewOpenAIDecoder(httpResponse.Body)
+		if assembler != nil {
+			decoder.OnData = assembler.Add
+		}
+		if err := relay(c, span, decoder, builder); err != nil {
+			span.SetStatus(codes.Error, err.Error())
+			return
+		}
+		store(builder)
+	}
+}
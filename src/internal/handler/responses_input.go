@@ -0,0 +1,298 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"ollama-api-proxy/src/internal/dto/newapi"
+)
+
+// responsesInputItem is an item of the Responses API input: a message
+// (with or without "type"), a function call or a function call output.
+type responsesInputItem struct {
+	Type      string          `json:"type"`
+	Role      string          `json:"role"`
+	Content   json.RawMessage `json:"content"`
+	CallId    string          `json:"call_id"`
+	Name      string          `json:"name"`
+	Arguments string          `json:"arguments"`
+	Output    json.RawMessage `json:"output"`
+}
+
+type responsesContentPart struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	ImageUrl string `json:"image_url"`
+	Detail   string `json:"detail"`
+	FileData string `json:"file_data"`
+	Filename string `json:"filename"`
+}
+
+type responsesText struct {
+	Format *struct {
+		Type        string `json:"type"`
+		Name        string `json:"name"`
+		Description string `json:"description"`
+		Schema      any    `json:"schema"`
+		Strict      any    `json:"strict"`
+	} `json:"format"`
+}
+
+// translateResponsesRequest converts a Responses API request into a chat
+// completion request continuing history. It also returns the conversation
+// without the instructions, which is what gets stored for the response.
+func translateResponsesRequest(req *newapi.OpenAIResponsesRequest, history []newapi.Message) (*newapi.GeneralOpenAIRequest, []newapi.Message, error) {
+	input, err := translateInput(req.Input)
+	if err != nil {
+		return nil, nil, err
+	}
+	conversation := append(append([]newapi.Message{}, history...), input...)
+
+	chatReq := &newapi.GeneralOpenAIRequest{
+		Model:            req.Model,
+		Stream:           req.Stream,
+		MaxTokens:        req.MaxOutputTokens,
+		Temperature:      req.Temperature,
+		ParallelTooCalls: req.ParallelToolCalls,
+		User:             req.User,
+	}
+	if req.TopP != nil {
+		chatReq.TopP = *req.TopP
+	}
+	if req.Stream {
+		chatReq.StreamOptions = &newapi.StreamOptions{IncludeUsage: true}
+	}
+	if req.Reasoning != nil {
+		chatReq.ReasoningEffort = req.Reasoning.Effort
+	}
+
+	if isSet(req.Instructions) {
+		var instructions string
+		if err := json.Unmarshal(req.Instructions, &instructions); err != nil {
+			return nil, nil, errors.New("instructions must be a string")
+		}
+		system := newapi.Message{Role: "system"}
+		system.SetStringContent(instructions)
+		chatReq.Messages = append(chatReq.Messages, system)
+	}
+	chatReq.Messages = append(chatReq.Messages, conversation...)
+
+	for _, tool := range req.Tools {
+		if tool.Type != "function" {
+			return nil, nil, fmt.Errorf("tool type '%s' is not supported", tool.Type)
+		}
+		function := newapi.FunctionRequest{Name: tool.Name, Description: tool.Description}
+		if len(tool.Parameters) > 0 {
+			function.Parameters = tool.Parameters
+		}
+		chatReq.Tools = append(chatReq.Tools, newapi.ToolCallRequest{Type: "function", Function: function})
+	}
+
+	if isSet(req.ToolChoice) {
+		if chatReq.ToolChoice, err = translateToolChoice(req.ToolChoice); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if isSet(req.Text) {
+		var text responsesText
+		if err := json.Unmarshal(req.Text, &text); err != nil {
+			return nil, nil, fmt.Errorf("invalid text: %w", err)
+		}
+		if format := text.Format; format != nil {
+			switch format.Type {
+			case "", "text":
+			case "json_object":
+				chatReq.ResponseFormat = &newapi.ResponseFormat{Type: "json_object"}
+			case "json_schema":
+				chatReq.ResponseFormat = &newapi.ResponseFormat{
+					Type: "json_schema",
+					JsonSchema: &newapi.FormatJsonSchema{
+						Name:        format.Name,
+						Description: format.Description,
+						Schema:      format.Schema,
+						Strict:      format.Strict,
+					},
+				}
+			default:
+				return nil, nil, fmt.Errorf("text format '%s' is not supported", format.Type)
+			}
+		}
+	}
+
+	return chatReq, conversation, nil
+}
+
+// translateInput converts the input, a string or a list of items, into chat
+// messages. Consecutive function calls become one assistant message and
+// reasoning items are dropped.
+func translateInput(raw json.RawMessage) ([]newapi.Message, error) {
+	if !isSet(raw) {
+		return nil, nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		message := newapi.Message{Role: "user"}
+		message.SetStringContent(text)
+		return []newapi.Message{message}, nil
+	}
+
+	var items []responsesInputItem
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, errors.New("input must be a string or a list of items")
+	}
+
+	var messages []newapi.Message
+	var calls []newapi.ToolCallRequest
+	flushCalls := func() {
+		if len(calls) == 0 {
+			return
+		}
+		message := newapi.Message{Role: "assistant"}
+		message.SetNullContent()
+		message.SetToolCalls(calls)
+		messages = append(messages, message)
+		calls = nil
+	}
+
+	for i, item := range items {
+		switch item.Type {
+		case "function_call":
+			calls = append(calls, newapi.ToolCallRequest{
+				ID:       item.CallId,
+				Type:     "function",
+				Function: newapi.FunctionRequest{Name: item.Name, Arguments: item.Arguments},
+			})
+			continue
+		case "reasoning":
+			continue
+		}
+		flushCalls()
+
+		switch item.Type {
+		case "", "message":
+			message, err := translateInputMessage(item)
+			if err != nil {
+				return nil, fmt.Errorf("input[%d]: %w", i, err)
+			}
+			messages = append(messages, message)
+		case "function_call_output":
+			message := newapi.Message{Role: "tool", ToolCallId: item.CallId}
+			output, err := outputText(item.Output)
+			if err != nil {
+				return nil, fmt.Errorf("input[%d]: %w", i, err)
+			}
+			message.SetStringContent(output)
+			messages = append(messages, message)
+		default:
+			return nil, fmt.Errorf("input[%d]: item type '%s' is not supported", i, item.Type)
+		}
+	}
+	flushCalls()
+	return messages, nil
+}
+
+func translateInputMessage(item responsesInputItem) (newapi.Message, error) {
+	role := item.Role
+	switch role {
+	case "user", "assistant", "system":
+	case "developer":
+		// Not every chat completions upstream knows the developer role.
+		role = "system"
+	default:
+		return newapi.Message{}, fmt.Errorf("role '%s' is not supported", item.Role)
+	}
+	message := newapi.Message{Role: role}
+
+	var text string
+	if err := json.Unmarshal(item.Content, &text); err == nil {
+		message.SetStringContent(text)
+		return message, nil
+	}
+	var parts []responsesContentPart
+	if err := json.Unmarshal(item.Content, &parts); err != nil {
+		return newapi.Message{}, errors.New("content must be a string or a list of parts")
+	}
+
+	var contents []newapi.MediaContent
+	for _, part := range parts {
+		switch part.Type {
+		case "input_text", "output_text":
+			contents = append(contents, newapi.MediaContent{Type: newapi.ContentTypeText, Text: part.Text})
+		case "refusal":
+		case "input_image":
+			if part.ImageUrl == "" {
+				return newapi.Message{}, errors.New("input_image without image_url is not supported")
+			}
+			imageUrl := map[string]string{"url": part.ImageUrl}
+			if part.Detail != "" {
+				imageUrl["detail"] = part.Detail
+			}
+			contents = append(contents, newapi.MediaContent{Type: newapi.ContentTypeImageURL, ImageUrl: imageUrl})
+		case "input_file":
+			if part.FileData == "" {
+				return newapi.Message{}, errors.New("input_file without file_data is not supported")
+			}
+			contents = append(contents, newapi.MediaContent{
+				Type: newapi.ContentTypeFile,
+				File: newapi.MessageFile{FileName: part.Filename, FileData: part.FileData},
+			})
+		default:
+			return newapi.Message{}, fmt.Errorf("content type '%s' is not supported", part.Type)
+		}
+	}
+
+	// Assistant turns are sent as plain text, which every upstream accepts.
+	if role == "assistant" {
+		var text strings.Builder
+		for _, content := range contents {
+			text.WriteString(content.Text)
+		}
+		message.SetStringContent(text.String())
+		return message, nil
+	}
+	message.SetMediaContent(contents)
+	return message, nil
+}
+
+// outputText returns a function call output, a string or a list of content
+// parts, as text.
+func outputText(raw json.RawMessage) (string, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil
+	}
+	var parts []responsesContentPart
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", errors.New("output must be a string or a list of parts")
+	}
+	var out strings.Builder
+	for _, part := range parts {
+		out.WriteString(part.Text)
+	}
+	return out.String(), nil
+}
+
+// translateToolChoice maps a Responses tool_choice to the chat form; only
+// function choices differ.
+func translateToolChoice(raw json.RawMessage) (any, error) {
+	var mode string
+	if err := json.Unmarshal(raw, &mode); err == nil {
+		return mode, nil
+	}
+	var choice struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(raw, &choice); err != nil || choice.Type != "function" {
+		return nil, errors.New("tool_choice must be a mode or a function")
+	}
+	return map[string]any{"type": "function", "function": map[string]string{"name": choice.Name}}, nil
+}
+
+// isSet reports whether an optional raw JSON field was sent.
+func isSet(raw json.RawMessage) bool {
+	return len(raw) > 0 && string(raw) != "null"
+}
@@ -0,0 +1,328 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"ollama-api-proxy/src/internal/dto/newapi"
+	"ollama-api-proxy/src/internal/dto/openai"
+	"ollama-api-proxy/src/internal/stream"
+
+	"github.com/gin-gonic/gin"
+)
+
+// responseBuilder assembles a Responses API response from chat completion
+// output. When emit is set, every change is also reported as a streaming
+// event.
+type responseBuilder struct {
+	resp *openai.Response
+	emit func(event string, data gin.H)
+	seq  int
+
+	reasoning *openai.ResponseReasoning
+	message   *openai.ResponseMessage
+	calls     map[int]*openai.ResponseFunctionCall
+	indexes   map[string]int
+	reason    string
+	usage     *openai.Usage
+}
+
+func newResponseBuilder(req *newapi.OpenAIResponsesRequest, emit func(event string, data gin.H)) *responseBuilder {
+	resp := &openai.Response{
+		Id:                "resp_" + newItemID(),
+		Object:            "response",
+		CreatedAt:         time.Now().Unix(),
+		Status:            "in_progress",
+		Instructions:      rawOrNull(req.Instructions),
+		Model:             req.Model,
+		Output:            []any{},
+		ParallelToolCalls: req.ParallelToolCalls == nil || *req.ParallelToolCalls,
+		Store:             req.Store == nil || *req.Store,
+		Temperature:       req.Temperature,
+		ToolChoice:        rawOrNull(req.ToolChoice),
+		TopP:              req.TopP,
+		Metadata:          req.Metadata,
+	}
+	if req.MaxOutputTokens > 0 {
+		resp.MaxOutputTokens = &req.MaxOutputTokens
+	}
+	if req.PreviousResponseID != "" {
+		resp.PreviousResponseID = &req.PreviousResponseID
+	}
+	resp.Tools, _ = json.Marshal(req.Tools)
+	if req.Tools == nil {
+		resp.Tools = json.RawMessage("[]")
+	}
+	if !isSet(resp.Metadata) {
+		resp.Metadata = json.RawMessage("{}")
+	}
+	if !isSet(resp.ToolChoice) {
+		resp.ToolChoice = json.RawMessage(`"auto"`)
+	}
+	return &responseBuilder{
+		resp:    resp,
+		emit:    emit,
+		calls:   make(map[int]*openai.ResponseFunctionCall),
+		indexes: make(map[string]int),
+	}
+}
+
+func (b *responseBuilder) event(event string, data gin.H) {
+	if b.emit == nil {
+		return
+	}
+	data["type"] = event
+	data["sequence_number"] = b.seq
+	b.seq++
+	b.emit(event, data)
+}
+
+func (b *responseBuilder) start() {
+	b.event("response.created", gin.H{"response": b.resp})
+	b.event("response.in_progress", gin.H{"response": b.resp})
+}
+
+// add appends a new output item, closing the open ones first.
+func (b *responseBuilder) add(id string, item any) int {
+	b.close("completed")
+	index := len(b.resp.Output)
+	b.resp.Output = append(b.resp.Output, item)
+	b.indexes[id] = index
+	b.event("response.output_item.added", gin.H{"output_index": index, "item": item})
+	return index
+}
+
+func (b *responseBuilder) addReasoning(delta string) {
+	if delta == "" {
+		return
+	}
+	if b.reasoning == nil {
+		item := &openai.ResponseReasoning{Type: "reasoning", Id: "rs_" + newItemID(), Summary: []openai.ResponseSummary{}}
+		index := b.add(item.Id, item)
+		item.Summary = append(item.Summary, openai.ResponseSummary{Type: "summary_text"})
+		b.event("response.reasoning_summary_part.added", gin.H{
+			"item_id": item.Id, "output_index": index, "summary_index": 0, "part": item.Summary[0],
+		})
+		b.reasoning = item
+	}
+	b.reasoning.Summary[0].Text += delta
+	b.event("response.reasoning_summary_text.delta", gin.H{
+		"item_id": b.reasoning.Id, "output_index": b.indexes[b.reasoning.Id], "summary_index": 0, "delta": delta,
+	})
+}
+
+func (b *responseBuilder) addText(delta string) {
+	if delta == "" {
+		return
+	}
+	if b.message == nil {
+		item := &openai.ResponseMessage{
+			Type: "message", Id: "msg_" + newItemID(), Status: "in_progress", Role: "assistant", Content: []openai.ResponseOutput{},
+		}
+		index := b.add(item.Id, item)
+		item.Content = append(item.Content, openai.ResponseOutput{Type: "output_text", Annotations: []any{}})
+		b.event("response.content_part.added", gin.H{
+			"item_id": item.Id, "output_index": index, "content_index": 0, "part": item.Content[0],
+		})
+		b.message = item
+	}
+	b.message.Content[0].Text += delta
+	b.event("response.output_text.delta", gin.H{
+		"item_id": b.message.Id, "output_index": b.indexes[b.message.Id], "content_index": 0, "delta": delta,
+	})
+}
+
+// Encode adds the events of the first choice to the response.
+func (b *responseBuilder) Encode(events []stream.Event) error {
+	for _, event := range events {
+		if event.Type != stream.Usage && event.Choice != 0 {
+			continue
+		}
+		switch event.Type {
+		case stream.Reasoning:
+			b.addReasoning(event.Text)
+		case stream.Text:
+			b.addText(event.Text)
+		case stream.ToolCall:
+			b.addToolCall(event.Call)
+		case stream.Finish:
+			b.reason = event.Reason
+		case stream.Usage:
+			b.usage = event.Usage
+		}
+	}
+	return nil
+}
+
+// addToolCall adds a complete tool call or a streamed fragment of one.
+func (b *responseBuilder) addToolCall(call stream.Call) {
+	item, ok := b.calls[call.Index]
+	if !ok {
+		callId := call.ID
+		if callId == "" {
+			callId = "call_" + newItemID()
+		}
+		item = &openai.ResponseFunctionCall{
+			Type: "function_call", Id: "fc_" + newItemID(), Status: "in_progress", CallId: callId, Name: call.Name,
+		}
+		b.add(item.Id, item)
+		b.calls[call.Index] = item
+	}
+	if call.Arguments == "" {
+		return
+	}
+	item.Arguments += call.Arguments
+	b.event("response.function_call_arguments.delta", gin.H{
+		"item_id": item.Id, "output_index": b.indexes[item.Id], "delta": call.Arguments,
+	})
+}
+
+// close finishes the open output items with status.
+func (b *responseBuilder) close(status string) {
+	if item := b.reasoning; item != nil {
+		index := b.indexes[item.Id]
+		b.event("response.reasoning_summary_text.done", gin.H{
+			"item_id": item.Id, "output_index": index, "summary_index": 0, "text": item.Summary[0].Text,
+		})
+		b.event("response.reasoning_summary_part.done", gin.H{
+			"item_id": item.Id, "output_index": index, "summary_index": 0, "part": item.Summary[0],
+		})
+		b.event("response.output_item.done", gin.H{"output_index": index, "item": item})
+		b.reasoning = nil
+	}
+	if item := b.message; item != nil {
+		index := b.indexes[item.Id]
+		item.Status = status
+		b.event("response.output_text.done", gin.H{
+			"item_id": item.Id, "output_index": index, "content_index": 0, "text": item.Content[0].Text,
+		})
+		b.event("response.content_part.done", gin.H{
+			"item_id": item.Id, "output_index": index, "content_index": 0, "part": item.Content[0],
+		})
+		b.event("response.output_item.done", gin.H{"output_index": index, "item": item})
+		b.message = nil
+	}
+	// Finish the calls in output order, the order of the output array.
+	keys := slices.SortedFunc(maps.Keys(b.calls), func(i, j int) int {
+		return b.indexes[b.calls[i].Id] - b.indexes[b.calls[j].Id]
+	})
+	for _, key := range keys {
+		item := b.calls[key]
+		index := b.indexes[item.Id]
+		item.Status = status
+		b.event("response.function_call_arguments.done", gin.H{
+			"item_id": item.Id, "output_index": index, "arguments": item.Arguments,
+		})
+		b.event("response.output_item.done", gin.H{"output_index": index, "item": item})
+		// Later fragments of the same index start a new call.
+		delete(b.calls, key)
+	}
+}
+
+// Close ends the response with the upstream finish reason and usage.
+func (b *responseBuilder) Close() error {
+	status := "completed"
+	switch b.reason {
+	case "length":
+		status = "incomplete"
+		b.resp.IncompleteDetails = &openai.IncompleteDetails{Reason: "max_output_tokens"}
+	case "content_filter":
+		status = "incomplete"
+		b.resp.IncompleteDetails = &openai.IncompleteDetails{Reason: "content_filter"}
+	}
+	b.close(status)
+	b.resp.Status = status
+	if b.usage != nil {
+		b.resp.Usage = &openai.ResponseUsage{
+			InputTokens:  b.usage.PromptTokens,
+			OutputTokens: b.usage.CompletionTokens,
+			TotalTokens:  b.usage.TotalTokens,
+		}
+	}
+	b.event("response."+status, gin.H{"response": b.resp})
+	return nil
+}
+
+// Fail closes the response after an upstream error.
+func (b *responseBuilder) Fail(err error) error {
+	b.close("incomplete")
+	b.resp.Status = "failed"
+	b.resp.Error = &openai.Error{Type: "server_error", Message: stream.ErrorMessage(err)}
+	var upstreamErr *openai.UpstreamError
+	if errors.As(err, &upstreamErr) {
+		b.resp.Error = &upstreamErr.Err
+	}
+	b.event("response.failed", gin.H{"response": b.resp})
+	return nil
+}
+
+// writeResponsesError writes err as a Responses API error event.
+func writeResponsesError(w io.Writer, err error) error {
+	e := openai.Error{Type: "server_error", Message: stream.ErrorMessage(err)}
+	var upstreamErr *openai.UpstreamError
+	if errors.As(err, &upstreamErr) {
+		e = upstreamErr.Err
+	}
+	code := e.Type
+	if e.Code != nil {
+		code = *e.Code
+	}
+	data, err := json.Marshal(gin.H{"type": "error", "code": code, "message": e.Message, "param": e.Param})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+	return err
+}
+
+// assistantMessage returns the response output as a chat message, for the
+// conversation store.
+func (b *responseBuilder) assistantMessage() newapi.Message {
+	message := newapi.Message{Role: "assistant"}
+	var text strings.Builder
+	var calls []newapi.ToolCallRequest
+	for _, item := range b.resp.Output {
+		switch item := item.(type) {
+		case *openai.ResponseMessage:
+			for _, content := range item.Content {
+				text.WriteString(content.Text)
+			}
+		case *openai.ResponseFunctionCall:
+			calls = append(calls, newapi.ToolCallRequest{
+				ID:       item.CallId,
+				Type:     "function",
+				Function: newapi.FunctionRequest{Name: item.Name, Arguments: item.Arguments},
+			})
+		}
+	}
+	if text.Len() > 0 || len(calls) == 0 {
+		message.SetStringContent(text.String())
+	} else {
+		message.SetNullContent()
+	}
+	if len(calls) > 0 {
+		message.SetToolCalls(calls)
+	}
+	return message
+}
+
+func newItemID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func rawOrNull(raw json.RawMessage) json.RawMessage {
+	if !isSet(raw) {
+		return json.RawMessage("null")
+	}
+	return raw
+}
@@ -0,0 +1,222 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"ollama-api-proxy/src/internal/dto/newapi"
+	"ollama-api-proxy/src/internal/dto/openai"
+	"ollama-api-proxy/src/internal/stream"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTranslateInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			"string",
+			`"hello"`,
+			`[{"role":"user","content":"hello"}]`,
+		},
+		{
+			"developer is system",
+			`[{"role":"developer","content":"be brief"},{"type":"message","role":"user","content":[{"type":"input_text","text":"hi"}]}]`,
+			`[{"role":"system","content":"be brief"},{"role":"user","content":[{"type":"text","text":"hi"}]}]`,
+		},
+		{
+			"assistant content flattened",
+			`[{"role":"assistant","content":[{"type":"output_text","text":"Hel"},{"type":"refusal","refusal":"no"},{"type":"output_text","text":"lo"}]}]`,
+			`[{"role":"assistant","content":"Hello"}]`,
+		},
+		{
+			"function calls grouped",
+			`[{"role":"user","content":"weather?"},
+			  {"type":"reasoning","id":"rs_1","summary":[]},
+			  {"type":"function_call","call_id":"call_1","name":"weather","arguments":"{\"city\":\"Paris\"}"},
+			  {"type":"function_call","call_id":"call_2","name":"weather","arguments":"{\"city\":\"Rome\"}"},
+			  {"type":"function_call_output","call_id":"call_1","output":"sunny"},
+			  {"type":"function_call_output","call_id":"call_2","output":[{"type":"input_text","text":"rainy"}]},
+			  {"type":"function_call","call_id":"call_3","name":"time","arguments":"{}"}]`,
+			`[{"role":"user","content":"weather?"},
+			  {"role":"assistant","content":null,"tool_calls":[
+			    {"id":"call_1","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Paris\"}"}},
+			    {"id":"call_2","type":"function","function":{"name":"weather","arguments":"{\"city\":\"Rome\"}"}}]},
+			  {"role":"tool","content":"sunny","tool_call_id":"call_1"},
+			  {"role":"tool","content":"rainy","tool_call_id":"call_2"},
+			  {"role":"assistant","content":null,"tool_calls":[
+			    {"id":"call_3","type":"function","function":{"name":"time","arguments":"{}"}}]}]`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, err := translateInput(json.RawMessage(tt.input))
+			require.NoError(t, err)
+			out, err := json.Marshal(messages)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.want, string(out))
+		})
+	}
+}
+
+func TestTranslateInputErrors(t *testing.T) {
+	for _, input := range []string{
+		`42`,
+		`[{"role":"tool","content":"x"}]`,
+		`[{"type":"web_search_call"}]`,
+		`[{"role":"user","content":[{"type":"input_audio"}]}]`,
+	} {
+		_, err := translateInput(json.RawMessage(input))
+		assert.Error(t, err, input)
+	}
+}
+
+// chatUpstream answers chat completions with reply and sends the requests
+// it receives to requests.
+func chatUpstream(t *testing.T, reply string, requests chan<- newapi.GeneralOpenAIRequest) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req newapi.GeneralOpenAIRequest
+		body, _ := io.ReadAll(r.Body)
+		require.NoError(t, json.Unmarshal(body, &req))
+		if requests != nil {
+			requests <- req
+		}
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, chunk := range []string{
+				`{"choices":[{"index":0,"delta":{"role":"assistant","content":"` + reply[:2] + `"},"finish_reason":null}]}`,
+				`{"choices":[{"index":0,"delta":{"content":"` + reply[2:] + `"},"finish_reason":"stop"}]}`,
+				`{"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}`,
+				`[DONE]`,
+			} {
+				io.WriteString(w, "data: "+chunk+"\n\n")
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"id":"c1","object":"chat.completion","created":1,"model":"gpt-4.1","choices":[{"index":0,"message":{"role":"assistant","content":"`+reply+`"},"finish_reason":"stop"}],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}`)
+	}
+}
+
+func messageContents(messages []newapi.Message) []string {
+	var contents []string
+	for _, message := range messages {
+		contents = append(contents, message.Role+": "+message.StringContent())
+	}
+	return contents
+}
+
+func TestResponsesContinuation(t *testing.T) {
+	requests := make(chan newapi.GeneralOpenAIRequest, 1)
+	handler := Responses(testState(t, "", chatUpstream(t, "Hi there", requests)))
+
+	w := serve(handler, `{"model":"gpt-4.1","instructions":"be nice","input":"hello"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"system: be nice", "user: hello"}, messageContents((<-requests).Messages))
+	var first openai.Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &first))
+	assert.Equal(t, "completed", first.Status)
+	assert.Equal(t, 5, first.Usage.InputTokens)
+
+	w = serve(handler, `{"model":"gpt-4.1","previous_response_id":"`+first.Id+`","input":"again","store":false}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []string{"user: hello", "assistant: Hi there", "user: again"}, messageContents((<-requests).Messages),
+		"The history should be continued without the earlier instructions")
+	var second openai.Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &second))
+	assert.Equal(t, first.Id, *second.PreviousResponseID)
+
+	w = serve(handler, `{"model":"gpt-4.1","previous_response_id":"`+second.Id+`","input":"more"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code, "Responses with store false should not be kept")
+	var resp openai.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "previous_response_not_found", *resp.Error.Code)
+}
+
+// sseEvents returns the event names and data of a named-event SSE stream.
+func sseEvents(t *testing.T, body string) ([]string, []map[string]any) {
+	t.Helper()
+	var names []string
+	var data []map[string]any
+	for _, event := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		for line := range strings.SplitSeq(event, "\n") {
+			if name, ok := strings.CutPrefix(line, "event:"); ok {
+				names = append(names, strings.TrimSpace(name))
+			}
+			if payload, ok := strings.CutPrefix(line, "data:"); ok {
+				var fields map[string]any
+				require.NoError(t, json.Unmarshal([]byte(payload), &fields))
+				data = append(data, fields)
+			}
+		}
+	}
+	return names, data
+}
+
+func TestResponsesStream(t *testing.T) {
+	appState := testState(t, "", chatUpstream(t, "Hello", nil))
+
+	w := serve(Responses(appState), `{"model":"gpt-4.1","input":"hi","stream":true}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	names, data := sseEvents(t, w.Body.String())
+	assert.Equal(t, []string{
+		"response.created",
+		"response.in_progress",
+		"response.output_item.added",
+		"response.content_part.added",
+		"response.output_text.delta",
+		"response.output_text.delta",
+		"response.output_text.done",
+		"response.content_part.done",
+		"response.output_item.done",
+		"response.completed",
+	}, names)
+	for i, fields := range data {
+		assert.Equal(t, names[i], fields["type"])
+		assert.Equal(t, float64(i), fields["sequence_number"])
+	}
+	assert.Equal(t, "He", data[4]["delta"])
+	assert.Equal(t, "Hello", data[6]["text"])
+
+	final := data[len(data)-1]["response"].(map[string]any)
+	assert.Equal(t, "completed", final["status"])
+	assert.Equal(t, float64(7), final["usage"].(map[string]any)["total_tokens"])
+
+	// Streamed responses are stored like the others.
+	_, ok := appState.Conversations.Get(final["id"].(string))
+	assert.True(t, ok)
+}
+
+func TestResponseBuilderCallOrder(t *testing.T) {
+	var done []int
+	builder := newResponseBuilder(&newapi.OpenAIResponsesRequest{Model: "gpt-4.1"}, func(event string, data gin.H) {
+		if event == "response.function_call_arguments.done" {
+			done = append(done, data["output_index"].(int))
+		}
+	})
+	var events []stream.Event
+	var want []int
+	for i := range 20 {
+		want = append(want, i)
+		events = append(events, stream.Event{Type: stream.ToolCall, Call: stream.Call{
+			Index: i, ID: fmt.Sprintf("call_%d", i), Name: "weather", Arguments: "{}",
+		}})
+	}
+	require.NoError(t, builder.Encode(append(events, stream.Event{Type: stream.Finish, Reason: "tool_calls"})))
+	require.NoError(t, builder.Close())
+
+	assert.Equal(t, want, done, "Calls should be finished in output order")
+	for i, item := range builder.resp.Output {
+		assert.Equal(t, fmt.Sprintf("call_%d", i), item.(*openai.ResponseFunctionCall).CallId)
+	}
+}
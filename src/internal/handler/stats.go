@@ -0,0 +1,14 @@
+package handler
+
+import (
+	"net/http"
+
+	"ollama-api-proxy/src/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetStats serves the proxy's counters on the admin API.
+func GetStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"aborted_requests": middleware.AbortedRequests()})
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"encoding/json"
+
+	"ollama-api-proxy/src/internal/config"
+	"ollama-api-proxy/src/internal/dto/newapi"
+	"ollama-api-proxy/src/internal/tokenizer"
+)
+
+// TruncatedHeader reports how many messages were dropped from the prompt.
+const TruncatedHeader = "X-Truncated-Messages"
+
+// ollamaOptions is the subset of Ollama request options the proxy reads.
+type ollamaOptions struct {
+	NumCtx           int      `json:"num_ctx"`
+	NumPredict       int      `json:"num_predict"`
+	Temperature      *float64 `json:"temperature"`
+	TopP             float64  `json:"top_p"`
+	TopK             int      `json:"top_k"`
+	Seed             float64  `json:"seed"`
+	Stop             []string `json:"stop"`
+	PresencePenalty  float64  `json:"presence_penalty"`
+	FrequencyPenalty float64  `json:"frequency_penalty"`
+}
+
+// truncateMessages drops messages from req according to the model's
+// truncation policy until the prompt fits the input limit, or the client's
+// num_ctx when smaller, and returns the updated payload and the number of
+// dropped messages. Ollama "options" are removed from the payload, since
+// OpenAI-compatible upstreams reject them.
+func truncateMessages(payload []byte, req *newapi.GeneralOpenAIRequest, info *config.ModelInfo, tok *tokenizer.Tokenizer) ([]byte, int, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &fields); err != nil {
+		return nil, 0, err
+	}
+	var options ollamaOptions
+	rawOptions, hasOptions := fields["options"]
+	if hasOptions {
+		json.Unmarshal(rawOptions, &options)
+		delete(fields, "options")
+	}
+
+	policy := info.GetTruncation()
+	limit := info.GetInputTokens()
+	if options.NumCtx > 0 && (limit == 0 || options.NumCtx < limit) {
+		limit = options.NumCtx
+	}
+	if policy == nil || limit == 0 {
+		if hasOptions {
+			payload, err := json.Marshal(fields)
+			return payload, 0, err
+		}
+		return payload, 0, nil
+	}
+
+	total, _ := countPrompt(req, info, tok)
+	if total <= limit {
+		if hasOptions {
+			payload, err := json.Marshal(fields)
+			return payload, 0, err
+		}
+		return payload, 0, nil
+	}
+
+	encoding := modelEncoding(info)
+	groups := messageGroups(req.Messages)
+	dropped := make([]bool, len(groups))
+	for total > limit {
+		i := pickGroup(groups, dropped, policy)
+		if i < 0 {
+			break
+		}
+		dropped[i] = true
+		for _, idx := range groups[i].indices {
+			n, _ := tok.CountMessage(encoding, &req.Messages[idx])
+			total -= n
+		}
+	}
+
+	var kept []newapi.Message
+	removed := 0
+	for i, group := range groups {
+		if dropped[i] {
+			removed += len(group.indices)
+			continue
+		}
+		for _, idx := range group.indices {
+			kept = append(kept, req.Messages[idx])
+		}
+	}
+	req.Messages = kept
+
+	messages, err := json.Marshal(kept)
+	if err != nil {
+		return nil, 0, err
+	}
+	fields["messages"] = messages
+	payload, err = json.Marshal(fields)
+	return payload, removed, err
+}
+
+// messageGroup is a run of messages that are dropped together: a turn, or an
+// assistant tool call with its tool results.
+type messageGroup struct {
+	indices []int
+	system  bool
+}
+
+func messageGroups(messages []newapi.Message) []messageGroup {
+	var groups []messageGroup
+	for i, message := range messages {
+		if message.Role == "tool" && len(groups) > 0 && !groups[len(groups)-1].system {
+			last := &groups[len(groups)-1]
+			last.indices = append(last.indices, i)
+			continue
+		}
+		groups = append(groups, messageGroup{
+			indices: []int{i},
+			system:  message.Role == "system" || message.Role == "developer",
+		})
+	}
+	return groups
+}
+
+// pickGroup returns the next group to drop, or -1 when none may be dropped.
+// System messages and the last group are never dropped.
+func pickGroup(groups []messageGroup, dropped []bool, policy *config.Truncation) int {
+	var candidates []int
+	turn := 0
+	turns := 0
+	for _, group := range groups {
+		if !group.system {
+			turns++
+		}
+	}
+	for i, group := range groups {
+		if group.system {
+			continue
+		}
+		turn++
+		if i == len(groups)-1 {
+			continue
+		}
+		if policy.Strategy == "first_last" && (turn <= policy.KeepFirst || turn > turns-policy.KeepLast) {
+			continue
+		}
+		if !dropped[i] {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return -1
+	}
+	if policy.Strategy == "middle_out" {
+		return candidates[len(candidates)/2]
+	}
+	return candidates[0]
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"ollama-api-proxy/src/internal/dto/newapi"
+	"ollama-api-proxy/src/internal/state"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const truncateModels = `
+models:
+  - name: "oldest"
+    config:
+      tokenizer: "cl100k_base"
+      input_tokens: 100000
+      truncation:
+        strategy: "oldest"
+  - name: "first-last"
+    config:
+      tokenizer: "cl100k_base"
+      input_tokens: 100000
+      truncation:
+        strategy: "first_last"
+        keep_first: 1
+        keep_last: 2
+  - name: "middle-out"
+    config:
+      tokenizer: "cl100k_base"
+      input_tokens: 100000
+      truncation:
+        strategy: "middle_out"
+  - name: "off"
+    config:
+      tokenizer: "cl100k_base"
+      input_tokens: 100000
+`
+
+// messageTokens is the size of every message of truncateConversation.
+const messageTokens = 100
+
+// truncateConversation returns a conversation whose messages are named by
+// their content prefix and count messageTokens each with the test tokenizer.
+// The assistant message a2 calls a tool answered by t2.
+func truncateConversation() []newapi.Message {
+	pad := func(role, name string, extra int) newapi.Message {
+		m := newapi.Message{Role: role}
+		// 3 tokens per message plus the role, counted one per byte.
+		m.SetStringContent(name + strings.Repeat(".", messageTokens-3-len(role)-len(name)-extra))
+		return m
+	}
+	calls := json.RawMessage(`[{"id":"call_1","type":"function","function":{"name":"f","arguments":"{}"}}]`)
+	a2 := pad("assistant", "a2", len(calls))
+	a2.ToolCalls = calls
+	t2 := pad("tool", "t2", 0)
+	t2.ToolCallId = "call_1"
+	return []newapi.Message{
+		pad("system", "sys", 0),
+		pad("user", "u1", 0),
+		pad("assistant", "a1", 0),
+		pad("user", "u2", 0),
+		a2,
+		t2,
+		pad("user", "u3", 0),
+		pad("assistant", "a3", 0),
+		pad("user", "u4", 0),
+	}
+}
+
+func messageNames(messages []newapi.Message) []string {
+	var names []string
+	for _, message := range messages {
+		names = append(names, strings.TrimRight(message.StringContent(), "."))
+	}
+	return names
+}
+
+func TestTruncateMessages(t *testing.T) {
+	models := testModels(t, truncateModels)
+	tok := testTokenizer()
+	// The conversation's prompt: 3 tokens to prime the reply and 9 messages.
+	total := 3 + 9*messageTokens
+
+	tests := []struct {
+		name  string
+		model string
+		// drop is how many tokens the limit is below the prompt.
+		drop int
+		want []string
+	}{
+		{"fits", "oldest", 0, []string{"sys", "u1", "a1", "u2", "a2", "t2", "u3", "a3", "u4"}},
+		{"oldest", "oldest", 150, []string{"sys", "u2", "a2", "t2", "u3", "a3", "u4"}},
+		{"oldest keeps tool result with its call", "oldest", 350, []string{"sys", "u3", "a3", "u4"}},
+		{"oldest keeps system and last", "oldest", total - 1, []string{"sys", "u4"}},
+		{"first_last", "first-last", 150, []string{"sys", "u1", "a2", "t2", "u3", "a3", "u4"}},
+		{"first_last keeps first and last turns", "first-last", total - 1, []string{"sys", "u1", "a3", "u4"}},
+		{"middle_out drops tool call with result", "middle-out", 150, []string{"sys", "u1", "a1", "u2", "u3", "a3", "u4"}},
+		{"middle_out", "middle-out", 250, []string{"sys", "u1", "a1", "u3", "a3", "u4"}},
+		{"no policy", "off", 150, []string{"sys", "u1", "a1", "u2", "a2", "t2", "u3", "a3", "u4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := &newapi.GeneralOpenAIRequest{
+				Model:    tt.model,
+				Messages: truncateConversation(),
+				Options:  json.RawMessage(fmt.Sprintf(`{"num_ctx":%d}`, total-tt.drop)),
+			}
+			payload, err := json.Marshal(req)
+			require.NoError(t, err)
+
+			out, removed, err := truncateMessages(payload, req, testModel(t, models, tt.model), tok)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, messageNames(req.Messages))
+			assert.Equal(t, 9-len(tt.want), removed)
+
+			var sent newapi.GeneralOpenAIRequest
+			require.NoError(t, json.Unmarshal(out, &sent))
+			assert.Equal(t, tt.want, messageNames(sent.Messages), "The payload should match the request")
+			assert.Nil(t, sent.Options, "Ollama options should not be sent upstream")
+		})
+	}
+}
+
+func TestTruncateHeader(t *testing.T) {
+	models := testModels(t, truncateModels)
+	appState := &state.State{Tokenizer: testTokenizer()}
+
+	req := &newapi.GeneralOpenAIRequest{
+		Model:    "oldest",
+		Messages: truncateConversation(),
+		Options:  json.RawMessage(`{"num_ctx":750}`),
+	}
+	c, w := testContext()
+	_, err := preparePayload(c, appState, req, testModel(t, models, "oldest"), "oldest")
+	require.NoError(t, err)
+	assert.Equal(t, "2", w.Header().Get(TruncatedHeader))
+
+	req = &newapi.GeneralOpenAIRequest{Model: "oldest", Messages: truncateConversation()}
+	c, w = testContext()
+	_, err = preparePayload(c, appState, req, testModel(t, models, "oldest"), "oldest")
+	require.NoError(t, err)
+	assert.Empty(t, w.Header().Get(TruncatedHeader), "Untruncated requests should not have the header")
+}
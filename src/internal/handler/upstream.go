@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"ollama-api-proxy/src/internal/config"
+	"ollama-api-proxy/src/internal/middleware"
+	"ollama-api-proxy/src/internal/state"
+	"ollama-api-proxy/src/internal/stream"
+
+	"github.com/gin-gonic/gin"
+)
+
+// withDeadline bounds the request context by the model's timeout, or the
+// global one, so upstream calls end with the client or at the deadline. The
+// returned function releases the context.
+func withDeadline(c *gin.Context, cfg *config.Config, modelInfo *config.ModelInfo) context.CancelFunc {
+	timeout := cfg.Timeout
+	if modelInfo != nil && modelInfo.GetTimeout() > 0 {
+		timeout = modelInfo.GetTimeout()
+	}
+	if timeout <= 0 {
+		return func() {}
+	}
+	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+	c.Request = c.Request.WithContext(ctx)
+	return cancel
+}
+
+// sendUpstream sends httpRequest and records the upstream latency. Stream
+// bodies fail with stream.ErrIdleTimeout when the upstream stalls for longer
+// than idle_timeout.
+func sendUpstream(c *gin.Context, appState *state.State, httpRequest *http.Request, streaming bool) (*http.Response, error) {
+	upstreamStart := time.Now()
+	httpResponse, err := appState.HttpClient.Do(httpRequest)
+	c.Set(middleware.KeyUpstreamLatency, time.Since(upstreamStart))
+	if err != nil {
+		return nil, err
+	}
+	if streaming {
+		httpResponse.Body = stream.NewIdleReader(httpResponse.Body, appState.Config().IdleTimeout)
+	}
+	return httpResponse, nil
+}
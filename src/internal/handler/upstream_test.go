@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"ollama-api-proxy/src/internal/config"
+	"ollama-api-proxy/src/internal/middleware"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const streamRequest = `{"model":"gpt-4.1","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+
+// stalledUpstream sends the first chunk of a stream and then stalls until
+// the proxy gives up on the request, which closes done.
+func stalledUpstream(done chan<- struct{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, `data: {"choices":[{"index":0,"delta":{"content":"Hel"},"finish_reason":null}]}`+"\n\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		close(done)
+	}
+}
+
+// serveLogged sends req to handler behind the access log, which counts
+// aborted requests.
+func serveLogged(handler gin.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(middleware.AccessLog())
+	engine.POST("/", handler)
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func TestChatCompletionAborts(t *testing.T) {
+	tests := []struct {
+		name   string
+		yml    string
+		idle   time.Duration
+		cancel bool
+		reason string
+	}{
+		{name: "idle", idle: 50 * time.Millisecond, reason: middleware.AbortIdle},
+		{name: "deadline", yml: "models:\n  - name: \"gpt-4.1\"\n    config:\n      timeout: 50ms\n", reason: middleware.AbortDeadline},
+		{name: "client", cancel: true, reason: middleware.AbortClient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			done := make(chan struct{})
+			appState := testState(t, tt.yml, stalledUpstream(done))
+			appState.Config().IdleTimeout = tt.idle
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				time.AfterFunc(50*time.Millisecond, cancel)
+			}
+			req := httptest.NewRequestWithContext(ctx, http.MethodPost, "/", strings.NewReader(streamRequest))
+
+			before := middleware.AbortedRequests()[tt.reason]
+			w := serveLogged(ChatCompletion(appState), req)
+
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("The upstream request should be aborted")
+			}
+			assert.Contains(t, w.Body.String(), `"content":"Hel"`)
+			assert.Equal(t, before+1, middleware.AbortedRequests()[tt.reason])
+		})
+	}
+}
+
+func TestWithDeadline(t *testing.T) {
+	models := testModels(t, "models:\n  - name: \"slow\"\n    config:\n      timeout: 1h\n")
+	cfg := config.Default()
+	cfg.Timeout = time.Minute
+
+	c, _ := testContext()
+	cancel := withDeadline(c, cfg, nil)
+	deadline, ok := c.Request.Context().Deadline()
+	require.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+	cancel()
+	assert.ErrorIs(t, c.Request.Context().Err(), context.Canceled)
+
+	c, _ = testContext()
+	defer withDeadline(c, cfg, testModel(t, models, "slow"))()
+	deadline, _ = c.Request.Context().Deadline()
+	assert.WithinDuration(t, time.Now().Add(time.Hour), deadline, time.Second, "The model's timeout should win")
+
+	cfg.Timeout = 0
+	c, _ = testContext()
+	defer withDeadline(c, cfg, nil)()
+	_, ok = c.Request.Context().Deadline()
+	assert.False(t, ok, "A zero timeout should not set a deadline")
+}
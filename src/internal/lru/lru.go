@@ -0,0 +1,76 @@
+// lru package is an in-memory least recently used cache with an optional
+// entry lifetime, shared by the response cache and the conversation store.
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type item[V any] struct {
+	key   string
+	value V
+	added time.Time
+}
+
+// Cache holds up to size values for ttl each. Zero disables the respective
+// limit. It is safe for concurrent use.
+type Cache[V any] struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	order *list.List
+	items map[string]*list.Element
+}
+
+func New[V any](size int, ttl time.Duration) *Cache[V] {
+	return &Cache[V]{
+		size:  size,
+		ttl:   ttl,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value of key and marks it as recently used. Expired
+// values are removed.
+func (c *Cache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+	elem, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	entry := elem.Value.(*item[V])
+	if c.ttl > 0 && time.Since(entry.added) > c.ttl {
+		c.order.Remove(elem)
+		delete(c.items, key)
+		return zero, false
+	}
+	c.order.MoveToFront(elem)
+	return entry.value, true
+}
+
+// Set stores value under key, evicting the least recently used values over
+// the size limit.
+func (c *Cache[V]) Set(key string, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*item[V])
+		entry.value = value
+		entry.added = time.Now()
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.items[key] = c.order.PushFront(&item[V]{key: key, value: value, added: time.Now()})
+	for c.size > 0 && c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*item[V]).key)
+	}
+}
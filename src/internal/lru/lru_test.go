@@ -0,0 +1,37 @@
+package lru
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEviction(t *testing.T) {
+	cache := New[int](2, 0)
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+	cache.Get("a")
+	cache.Set("c", 3)
+
+	_, ok := cache.Get("b")
+	assert.False(t, ok, "The least recently used value should be evicted")
+	value, ok := cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, value)
+
+	cache.Set("a", 10)
+	value, _ = cache.Get("a")
+	assert.Equal(t, 10, value, "Set should replace the value")
+}
+
+func TestExpiry(t *testing.T) {
+	cache := New[string](0, 10*time.Millisecond)
+	cache.Set("a", "x")
+	_, ok := cache.Get("a")
+	assert.True(t, ok)
+
+	time.Sleep(20 * time.Millisecond)
+	_, ok = cache.Get("a")
+	assert.False(t, ok, "Expired values should not be returned")
+}
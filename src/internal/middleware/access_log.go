@@ -0,0 +1,106 @@
+// middleware package contains the gin middlewares shared by all routes.
+package middleware
+
+import (
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Context keys the handlers fill in for the access log.
+const (
+	KeyRequestID        = "request_id"
+	KeyClient           = "client_key" // name of the key the client authenticated with
+	KeyModel            = "model"
+	KeyProvider         = "provider"
+	KeyStream           = "stream"
+	KeyUpstreamLatency  = "upstream_latency"
+	KeyPromptTokens     = "prompt_tokens"
+	KeyCompletionTokens = "completion_tokens"
+	KeyAborted          = "aborted"
+)
+
+// Reasons a request was aborted, recorded under KeyAborted.
+const (
+	AbortClient   = "client"   // the client went away
+	AbortDeadline = "deadline" // the total deadline passed
+	AbortIdle     = "idle"     // the upstream stream stalled
+)
+
+var abortedRequests = map[string]*atomic.Int64{
+	AbortClient:   {},
+	AbortDeadline: {},
+	AbortIdle:     {},
+}
+
+// AbortedRequests returns the number of aborted requests by reason since
+// the process started.
+func AbortedRequests() map[string]int64 {
+	counts := make(map[string]int64, len(abortedRequests))
+	for reason, count := range abortedRequests {
+		counts[reason] = count.Load()
+	}
+	return counts
+}
+
+// AccessLog writes one slog record per request through the default logger,
+// so it follows the configured log format and level.
+func AccessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+		if raw := c.Request.URL.RawQuery; raw != "" {
+			path = path + "?" + raw
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		attrs := []slog.Attr{
+			slog.String("request_id", c.GetString(KeyRequestID)),
+			slog.String("method", c.Request.Method),
+			slog.String("path", path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+		}
+		if client := c.GetString(KeyClient); client != "" {
+			attrs = append(attrs, slog.String("client_key", client))
+		}
+		if model := c.GetString(KeyModel); model != "" {
+			attrs = append(attrs,
+				slog.String("model", model),
+				slog.String("provider", c.GetString(KeyProvider)),
+				slog.Bool("stream", c.GetBool(KeyStream)),
+			)
+		}
+		if v, ok := c.Get(KeyUpstreamLatency); ok {
+			attrs = append(attrs, slog.Duration("upstream_latency", v.(time.Duration)))
+		}
+		if _, ok := c.Get(KeyPromptTokens); ok {
+			attrs = append(attrs,
+				slog.Int("prompt_tokens", c.GetInt(KeyPromptTokens)),
+				slog.Int("completion_tokens", c.GetInt(KeyCompletionTokens)),
+			)
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+		reason := c.GetString(KeyAborted)
+		if count, ok := abortedRequests[reason]; ok {
+			count.Add(1)
+			attrs = append(attrs, slog.String("aborted", reason))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400 || reason != "":
+			level = slog.LevelWarn
+		}
+		slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"ollama-api-proxy/src/internal/dto"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAuth requires the admin token as a bearer token and logs the client
+// as "admin".
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		got, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, dto.ErrorResponse{Error: "Unauthorized"})
+			return
+		}
+		c.Set(KeyClient, "admin")
+		c.Next()
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"log/slog"
 	"net/http"
 	"ollama-api-proxy/src/internal/handler"
+	"ollama-api-proxy/src/internal/middleware"
 	"ollama-api-proxy/src/internal/state"
 
 	"github.com/gin-gonic/gin"
@@ -17,12 +18,29 @@ func SetupRouter(engine *gin.Engine, appState *state.State) error {
 		apiRouter.GET("/version", handler.GetVersion)
 		apiRouter.GET("/tags", handler.GetModels(appState))
 		apiRouter.POST("/show", handler.GetModel(appState))
+		apiRouter.POST("/chat", handler.OllamaChat(appState))
 	}
 
 	// OpenAI API
 	v1Router := engine.Group("/v1")
 	{
 		v1Router.POST("/chat/completions", handler.ChatCompletion(appState))
+		v1Router.POST("/completions", handler.Completions(appState))
+		v1Router.POST("/responses", handler.Responses(appState))
+		// Anthropic Messages API
+		v1Router.POST("/messages", handler.Messages(appState))
+		v1Router.GET("/models", handler.ListOpenAIModels(appState))
+		// Model IDs may contain slashes, e.g. "openai/gpt-4.1".
+		v1Router.GET("/models/*id", handler.GetOpenAIModel(appState))
+	}
+
+	// Admin API, only mounted when a token is configured
+	if adminToken := appState.Config().AdminToken; adminToken != "" {
+		adminRouter := engine.Group("/admin", middleware.AdminAuth(adminToken))
+		{
+			adminRouter.POST("/models/refresh", handler.RefreshModels(appState))
+			adminRouter.GET("/stats", handler.GetStats)
+		}
 	}
 
 	engine.NoRoute(func(c *gin.Context) {
@@ -2,15 +2,56 @@ package state
 
 import (
 	"net/http"
+	"sync/atomic"
 
+	"ollama-api-proxy/src/internal/cache"
+	"ollama-api-proxy/src/internal/capture"
+	"ollama-api-proxy/src/internal/catalog"
 	"ollama-api-proxy/src/internal/config"
+	"ollama-api-proxy/src/internal/conversation"
+	"ollama-api-proxy/src/internal/tokenizer"
 
 	"github.com/gin-gonic/gin"
 )
 
+// State is shared by all handlers. The configuration, models and visibility
+// filter can be swapped at runtime by a reload; handlers should read each of
+// them once per request so in-flight requests keep a consistent view.
 type State struct {
-	Config     *config.Config
 	Router     *gin.Engine
 	HttpClient *http.Client
-	Models     *config.Models
+	Capture    *capture.Recorder
+	Cache      cache.Store
+	Catalog    *catalog.Catalog
+	Tokenizer  *tokenizer.Tokenizer
+	// Conversations backs previous_response_id of translated responses.
+	Conversations *conversation.Store
+
+	config     atomic.Pointer[config.Config]
+	models     atomic.Pointer[config.Models]
+	visibility atomic.Pointer[catalog.Filter]
+}
+
+func (s *State) Config() *config.Config {
+	return s.config.Load()
+}
+
+func (s *State) SetConfig(cfg *config.Config) {
+	s.config.Store(cfg)
+}
+
+func (s *State) Models() *config.Models {
+	return s.models.Load()
+}
+
+func (s *State) SetModels(models *config.Models) {
+	s.models.Store(models)
+}
+
+func (s *State) Visibility() *catalog.Filter {
+	return s.visibility.Load()
+}
+
+func (s *State) SetVisibility(filter *catalog.Filter) {
+	s.visibility.Store(filter)
 }
@@ -0,0 +1,49 @@
+package stream
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// ErrIdleTimeout is returned by readers of NewIdleReader when the upstream
+// sent nothing for longer than the idle timeout.
+var ErrIdleTimeout = errors.New("upstream stream idle timeout")
+
+type idleReader struct {
+	r       io.ReadCloser
+	timeout time.Duration
+	timer   *time.Timer
+	idle    atomic.Bool
+}
+
+// NewIdleReader returns r closed when no data arrives for timeout, which
+// unblocks a pending Read with ErrIdleTimeout. A zero timeout returns r.
+func NewIdleReader(r io.ReadCloser, timeout time.Duration) io.ReadCloser {
+	if timeout <= 0 {
+		return r
+	}
+	reader := &idleReader{r: r, timeout: timeout}
+	reader.timer = time.AfterFunc(timeout, func() {
+		reader.idle.Store(true)
+		r.Close()
+	})
+	return reader
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if r.idle.Load() {
+		return n, ErrIdleTimeout
+	}
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+func (r *idleReader) Close() error {
+	r.timer.Stop()
+	return r.r.Close()
+}
@@ -0,0 +1,41 @@
+package stream
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdleReader(t *testing.T) {
+	pr, pw := io.Pipe()
+	reader := NewIdleReader(pr, 50*time.Millisecond)
+	defer reader.Close()
+
+	// Chunks that keep arriving within the timeout are read normally.
+	go func() {
+		for range 3 {
+			time.Sleep(30 * time.Millisecond)
+			pw.Write([]byte("data"))
+		}
+	}()
+	buf := make([]byte, 16)
+	for range 3 {
+		n, err := reader.Read(buf)
+		require.NoError(t, err)
+		assert.Equal(t, "data", string(buf[:n]))
+	}
+
+	// The writer stalls; the pending read fails once the timeout passes.
+	start := time.Now()
+	_, err := reader.Read(buf)
+	assert.ErrorIs(t, err, ErrIdleTimeout)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestIdleReaderDisabled(t *testing.T) {
+	pr, _ := io.Pipe()
+	assert.Equal(t, io.ReadCloser(pr), NewIdleReader(pr, 0), "A zero timeout should return the reader itself")
+}
@@ -0,0 +1,160 @@
+package stream
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"ollama-api-proxy/src/internal/dto/ollama"
+	"ollama-api-proxy/src/internal/dto/openai"
+)
+
+// OllamaEncoder writes events as Ollama chat responses: NDJSON lines when
+// streaming, otherwise one response written at Close. Only the first choice
+// is encoded.
+type OllamaEncoder struct {
+	w      io.Writer
+	model  string
+	stream bool
+	// Thinking is dropped when false, for requests with think disabled.
+	Thinking bool
+
+	start     time.Time
+	message   ollama.Message
+	calls     []*Call
+	reason    string
+	usage     *openai.Usage
+	arguments map[int]*strings.Builder
+}
+
+func NewOllamaEncoder(w io.Writer, model string, stream bool) *OllamaEncoder {
+	return &OllamaEncoder{
+		w:         w,
+		model:     model,
+		stream:    stream,
+		Thinking:  true,
+		start:     time.Now(),
+		message:   ollama.Message{Role: "assistant"},
+		arguments: make(map[int]*strings.Builder),
+	}
+}
+
+func (e *OllamaEncoder) Encode(events []Event) error {
+	delta := ollama.Message{Role: "assistant"}
+	for _, event := range events {
+		if event.Type != Usage && event.Choice != 0 {
+			continue
+		}
+		switch event.Type {
+		case Text:
+			delta.Content += event.Text
+		case Reasoning:
+			if e.Thinking {
+				delta.Thinking += event.Text
+			}
+		case ToolCall:
+			// Ollama sends tool calls whole, so fragments are collected
+			// until the choice finishes.
+			args, ok := e.arguments[event.Call.Index]
+			if !ok {
+				call := event.Call
+				e.calls = append(e.calls, &call)
+				args = &strings.Builder{}
+				args.WriteString(call.Arguments)
+				e.arguments[call.Index] = args
+				continue
+			}
+			args.WriteString(event.Call.Arguments)
+		case Finish:
+			e.reason = event.Reason
+			delta.ToolCalls = e.toolCalls()
+		case Usage:
+			e.usage = event.Usage
+		}
+	}
+
+	if !e.stream {
+		e.message.Content += delta.Content
+		e.message.Thinking += delta.Thinking
+		e.message.ToolCalls = append(e.message.ToolCalls, delta.ToolCalls...)
+		return nil
+	}
+	if delta.Content == "" && delta.Thinking == "" && len(delta.ToolCalls) == 0 {
+		return nil
+	}
+	return e.write(ollama.ChatResponse{Model: e.model, CreatedAt: time.Now(), Message: delta})
+}
+
+func (e *OllamaEncoder) Close() error {
+	resp := ollama.ChatResponse{
+		Model:      e.model,
+		CreatedAt:  time.Now(),
+		Message:    ollama.Message{Role: "assistant"},
+		DoneReason: doneReason(e.reason),
+		Done:       true,
+	}
+	// Calls of a stream that ended without a finish reason.
+	pending := e.toolCalls()
+	if !e.stream {
+		resp.Message = e.message
+	}
+	resp.Message.ToolCalls = append(resp.Message.ToolCalls, pending...)
+	resp.TotalDuration = time.Since(e.start)
+	if e.usage != nil {
+		resp.PromptEvalCount = e.usage.PromptTokens
+		resp.EvalCount = e.usage.CompletionTokens
+	}
+	return e.write(resp)
+}
+
+// Fail writes the error line Ollama ends failed streams with.
+func (e *OllamaEncoder) Fail(err error) error {
+	data, err := json.Marshal(map[string]string{"error": ErrorMessage(err)})
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(append(data, '\n'))
+	return err
+}
+
+// toolCalls returns the collected tool calls with their arguments parsed.
+func (e *OllamaEncoder) toolCalls() []ollama.ToolCall {
+	var calls []ollama.ToolCall
+	for _, call := range e.calls {
+		var arguments ollama.ToolCallFunctionArguments
+		json.Unmarshal([]byte(e.arguments[call.Index].String()), &arguments)
+		if arguments == nil {
+			arguments = ollama.ToolCallFunctionArguments{}
+		}
+		calls = append(calls, ollama.ToolCall{Function: ollama.ToolCallFunction{
+			Index:     call.Index,
+			Name:      call.Name,
+			Arguments: arguments,
+		}})
+	}
+	e.calls = nil
+	clear(e.arguments)
+	return calls
+}
+
+func (e *OllamaEncoder) write(resp ollama.ChatResponse) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	_, err = e.w.Write(append(data, '\n'))
+	return err
+}
+
+// doneReason maps an OpenAI finish reason to Ollama's.
+func doneReason(reason string) string {
+	switch reason {
+	case "length":
+		return "length"
+	case "":
+		return ""
+	default:
+		return "stop"
+	}
+}
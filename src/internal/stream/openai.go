@@ -0,0 +1,320 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"ollama-api-proxy/src/internal/dto/openai"
+)
+
+// openAIChunk is the part of a chat completion, or of a chunk, that is
+// turned into events.
+type openAIChunk struct {
+	Choices []struct {
+		Index        int           `json:"index"`
+		Delta        openAIMessage `json:"delta"`
+		Message      openAIMessage `json:"message"`
+		FinishReason *string       `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openai.Usage `json:"usage"`
+}
+
+type openAIMessage struct {
+	Content          string            `json:"content"`
+	ReasoningContent string            `json:"reasoning_content"`
+	Reasoning        json.RawMessage   `json:"reasoning"`
+	ToolCalls        []openai.ToolCall `json:"tool_calls"`
+}
+
+// reasoning returns the reasoning text, sent as reasoning_content or, by
+// OpenRouter, as a reasoning string.
+func (m *openAIMessage) reasoning() string {
+	if m.ReasoningContent != "" {
+		return m.ReasoningContent
+	}
+	var text string
+	json.Unmarshal(m.Reasoning, &text)
+	return text
+}
+
+func (m *openAIMessage) events(choice int, streamed bool) []Event {
+	var events []Event
+	if reasoning := m.reasoning(); reasoning != "" {
+		events = append(events, Event{Type: Reasoning, Choice: choice, Text: reasoning})
+	}
+	if m.Content != "" {
+		events = append(events, Event{Type: Text, Choice: choice, Text: m.Content})
+	}
+	for i, call := range m.ToolCalls {
+		index := call.Index
+		if !streamed {
+			// Complete messages do not number their tool calls.
+			index = i
+		}
+		events = append(events, Event{Type: ToolCall, Choice: choice, Call: Call{
+			Index:     index,
+			ID:        call.ID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		}})
+	}
+	return events
+}
+
+func (c *openAIChunk) events(streamed bool) []Event {
+	var events []Event
+	for _, choice := range c.Choices {
+		message := choice.Message
+		if streamed {
+			message = choice.Delta
+		}
+		events = append(events, message.events(choice.Index, streamed)...)
+		if choice.FinishReason != nil {
+			events = append(events, Event{Type: Finish, Choice: choice.Index, Reason: *choice.FinishReason})
+		}
+	}
+	if c.Usage != nil {
+		events = append(events, Event{Type: Usage, Usage: c.Usage})
+	}
+	return events
+}
+
+// DecodeOpenAICompletion returns the events of a non-streamed chat
+// completion.
+func DecodeOpenAICompletion(body []byte) ([]Event, error) {
+	var completion openAIChunk
+	if err := json.Unmarshal(body, &completion); err != nil {
+		return nil, err
+	}
+	if len(completion.Choices) == 0 {
+		return nil, fmt.Errorf("chat completion without choices")
+	}
+	return completion.events(false), nil
+}
+
+// OpenAIDecoder decodes an OpenAI chat completion SSE stream.
+type OpenAIDecoder struct {
+	scanner *bufio.Scanner
+	// OnData, when set, receives the payload of every data line, e.g. for
+	// captures and caching.
+	OnData func(data []byte)
+	// KeepRaw adds a Raw event to every chunk, including chunks without
+	// other events, so an OpenAIEncoder passes the upstream chunks through
+	// with their IDs and the fields the event model does not know.
+	KeepRaw bool
+}
+
+func NewOpenAIDecoder(r io.Reader) *OpenAIDecoder {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	return &OpenAIDecoder{scanner: scanner}
+}
+
+func (d *OpenAIDecoder) Next() ([]Event, error) {
+	for d.scanner.Scan() {
+		data, ok := bytes.CutPrefix(d.scanner.Bytes(), []byte("data:"))
+		data = bytes.TrimSpace(data)
+		if !ok || len(data) == 0 {
+			continue
+		}
+		if string(data) == "[DONE]" {
+			return nil, io.EOF
+		}
+		if d.OnData != nil {
+			d.OnData(data)
+		}
+		var reply struct {
+			Error json.RawMessage `json:"error"`
+		}
+		if json.Unmarshal(data, &reply) == nil && len(reply.Error) > 0 && string(reply.Error) != "null" {
+			return nil, openai.ParseError(0, data)
+		}
+		var chunk openAIChunk
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			continue
+		}
+		events := chunk.events(true)
+		if d.KeepRaw {
+			events = append(events, Event{Type: Raw, Data: bytes.Clone(data)})
+		}
+		if len(events) > 0 {
+			return events, nil
+		}
+	}
+	if err := d.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// OpenAIEncoder writes events as chat.completion.chunk SSE lines, ending
+// with [DONE].
+type OpenAIEncoder struct {
+	w            io.Writer
+	id           string
+	model        string
+	created      int64
+	includeUsage bool
+	started      map[int]bool
+}
+
+// NewOpenAIEncoder returns an encoder for model. Usage chunks are only
+// written with includeUsage, as requested by stream_options.include_usage.
+func NewOpenAIEncoder(w io.Writer, model string, includeUsage bool) *OpenAIEncoder {
+	return &OpenAIEncoder{
+		w:            w,
+		id:           "chatcmpl-" + newID(),
+		model:        model,
+		created:      time.Now().Unix(),
+		includeUsage: includeUsage,
+		started:      make(map[int]bool),
+	}
+}
+
+func (e *OpenAIEncoder) Encode(events []Event) error {
+	for _, event := range events {
+		if event.Type == Raw {
+			return e.copy(event.Data)
+		}
+	}
+
+	chunk := e.chunk()
+	var usage *openai.Usage
+	for _, event := range events {
+		if event.Type == Usage {
+			usage = event.Usage
+			continue
+		}
+		choice := e.choice(&chunk, event.Choice)
+		switch event.Type {
+		case Text:
+			content, _ := choice.Delta.Content.(string)
+			choice.Delta.Content = content + event.Text
+		case Reasoning:
+			choice.Delta.ReasoningContent += event.Text
+		case ToolCall:
+			call := openai.ToolCall{ID: event.Call.ID, Index: event.Call.Index}
+			if event.Call.ID != "" {
+				call.Type = "function"
+			}
+			call.Function.Name = event.Call.Name
+			call.Function.Arguments = event.Call.Arguments
+			choice.Delta.ToolCalls = append(choice.Delta.ToolCalls, call)
+		case Finish:
+			reason := event.Reason
+			choice.FinishReason = &reason
+		}
+	}
+	if len(chunk.Choices) > 0 {
+		if err := e.write(chunk); err != nil {
+			return err
+		}
+	}
+	if usage != nil && e.includeUsage {
+		chunk := e.chunk()
+		chunk.Usage = usage
+		return e.write(chunk)
+	}
+	return nil
+}
+
+// copy writes an upstream chunk as is, apart from the model, which is the
+// one the client asked for, and the usage, which is dropped unless
+// requested. Chunks left without choices are skipped.
+func (e *OpenAIEncoder) copy(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil
+	}
+	if _, ok := fields["usage"]; ok && !e.includeUsage {
+		delete(fields, "usage")
+		var choices []json.RawMessage
+		if json.Unmarshal(fields["choices"], &choices) == nil && len(choices) == 0 {
+			return nil
+		}
+	}
+	if _, ok := fields["model"]; ok {
+		fields["model"], _ = json.Marshal(e.model)
+	}
+	out, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.w, "data: %s\n\n", out)
+	return err
+}
+
+func (e *OpenAIEncoder) Close() error {
+	_, err := io.WriteString(e.w, "data: [DONE]\n\n")
+	return err
+}
+
+// Fail writes the error as a final data line, in the shape OpenAI uses for
+// errors in streams.
+func (e *OpenAIEncoder) Fail(err error) error {
+	return WriteOpenAIError(e.w, err)
+}
+
+// WriteOpenAIError writes err as an SSE data line holding an OpenAI error.
+func WriteOpenAIError(w io.Writer, err error) error {
+	resp := openai.ErrorResponse{Error: openai.Error{Type: "server_error", Message: ErrorMessage(err)}}
+	var upstreamErr *openai.UpstreamError
+	if errors.As(err, &upstreamErr) {
+		resp.Error = upstreamErr.Err
+	}
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+	return err
+}
+
+func (e *OpenAIEncoder) chunk() openai.ChatCompletionChunk {
+	return openai.ChatCompletionChunk{
+		Id:      e.id,
+		Object:  "chat.completion.chunk",
+		Created: e.created,
+		Model:   e.model,
+		Choices: []openai.ChunkChoice{},
+	}
+}
+
+// choice returns the chunk's choice with the index, adding it when missing.
+// The first delta of every choice carries the assistant role.
+func (e *OpenAIEncoder) choice(chunk *openai.ChatCompletionChunk, index int) *openai.ChunkChoice {
+	for i := range chunk.Choices {
+		if chunk.Choices[i].Index == index {
+			return &chunk.Choices[i]
+		}
+	}
+	choice := openai.ChunkChoice{Index: index}
+	if !e.started[index] {
+		e.started[index] = true
+		choice.Delta.Role = "assistant"
+	}
+	chunk.Choices = append(chunk.Choices, choice)
+	return &chunk.Choices[len(chunk.Choices)-1]
+}
+
+func (e *OpenAIEncoder) write(chunk openai.ChatCompletionChunk) error {
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.w, "data: %s\n\n", data)
+	return err
+}
+
+func newID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,85 @@
+// stream package is the provider-neutral model of a chat completion: upstream
+// responses are decoded into events, which encoders write in each client
+// API's wire format.
+package stream
+
+import (
+	"context"
+	"errors"
+
+	"ollama-api-proxy/src/internal/dto/openai"
+)
+
+type Type int
+
+const (
+	// Text is a delta of the assistant message content.
+	Text Type = iota + 1
+	// Reasoning is a delta of the model's reasoning.
+	Reasoning
+	// ToolCall is a tool call or a fragment of one.
+	ToolCall
+	// Finish ends a choice.
+	Finish
+	// Usage reports the token counts of the whole response.
+	Usage
+	// Raw is the upstream chunk the other events of a batch were decoded
+	// from, for encoders of the same format that copy it instead.
+	Raw
+)
+
+type Event struct {
+	Type   Type
+	Choice int
+	// Text is the delta of Text and Reasoning events.
+	Text string
+	// Call is the fragment of ToolCall events. The first fragment of a call
+	// carries its ID and Name, later ones extend the Arguments.
+	Call Call
+	// Reason is the finish reason of Finish events in OpenAI terms: stop,
+	// length, tool_calls or content_filter.
+	Reason string
+	// Usage is set on Usage events.
+	Usage *openai.Usage
+	// Data is the upstream chunk of Raw events.
+	Data []byte
+}
+
+type Call struct {
+	Index     int
+	ID        string
+	Name      string
+	Arguments string
+}
+
+// Decoder reads the events of a streamed upstream response.
+type Decoder interface {
+	// Next returns the events of the next chunk, or io.EOF at the end of
+	// the stream. Errors sent by the upstream are *openai.UpstreamError.
+	Next() ([]Event, error)
+}
+
+// Encoder writes events in a client API's wire format.
+type Encoder interface {
+	Encode(events []Event) error
+	// Close writes whatever ends the response.
+	Close() error
+	// Fail ends the response with an error frame instead.
+	Fail(err error) error
+}
+
+// ErrorMessage is the message of err for clients: the upstream's own for
+// upstream errors, a generic one otherwise.
+func ErrorMessage(err error) string {
+	var upstreamErr *openai.UpstreamError
+	switch {
+	case errors.As(err, &upstreamErr):
+		return upstreamErr.Err.Message
+	case errors.Is(err, ErrIdleTimeout):
+		return "Upstream API stopped sending data"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "Upstream API timed out"
+	default:
+		return "Failed to read response from upstream API"
+	}
+}
@@ -0,0 +1,238 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"ollama-api-proxy/src/internal/dto/ollama"
+	"ollama-api-proxy/src/internal/dto/openai"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const textStream = `data: {"choices":[{"index":0,"delta":{"role":"assistant","content":"Hel"},"finish_reason":null}]}
+
+data: {"choices":[{"index":0,"delta":{"reasoning_content":"hmm"},"finish_reason":null}]}
+
+data: {"choices":[{"index":0,"delta":{"content":"lo"},"finish_reason":"stop"}]}
+
+data: {"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}
+
+data: [DONE]
+
+data: {"choices":[{"index":0,"delta":{"content":"after done"},"finish_reason":null}]}
+
+`
+
+// The arguments of a tool call arrive in fragments after its ID and name.
+const toolStream = `data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]},"finish_reason":null}]}
+
+data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]},"finish_reason":null}]}
+
+data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]},"finish_reason":"tool_calls"}]}
+
+data: [DONE]
+
+`
+
+const failedStream = `data: {"choices":[{"index":0,"delta":{"content":"Hel"},"finish_reason":null}]}
+
+data: {"error":{"message":"model overloaded","type":"server_error","code":null,"param":null}}
+
+`
+
+// roundTrip decodes an upstream SSE stream into enc the way the handlers
+// relay it.
+func roundTrip(upstream string, enc Encoder) error {
+	dec := NewOpenAIDecoder(strings.NewReader(upstream))
+	for {
+		events, err := dec.Next()
+		if err == io.EOF {
+			return enc.Close()
+		}
+		if err != nil {
+			enc.Fail(err)
+			return err
+		}
+		if err := enc.Encode(events); err != nil {
+			return err
+		}
+	}
+}
+
+// sseData returns the payloads of the data lines of an SSE stream.
+func sseData(t *testing.T, out string) []string {
+	t.Helper()
+	var data []string
+	for _, event := range strings.Split(strings.TrimSuffix(out, "\n\n"), "\n\n") {
+		payload, ok := strings.CutPrefix(event, "data: ")
+		require.True(t, ok, "unexpected SSE line %q", event)
+		data = append(data, payload)
+	}
+	return data
+}
+
+func sseChunks(t *testing.T, data []string) []openai.ChatCompletionChunk {
+	t.Helper()
+	var chunks []openai.ChatCompletionChunk
+	for _, payload := range data {
+		var chunk openai.ChatCompletionChunk
+		require.NoError(t, json.Unmarshal([]byte(payload), &chunk))
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+func ndjsonLines(t *testing.T, out string) []ollama.ChatResponse {
+	t.Helper()
+	var lines []ollama.ChatResponse
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		var resp ollama.ChatResponse
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &resp))
+		lines = append(lines, resp)
+	}
+	return lines
+}
+
+func TestOpenAIRoundTrip(t *testing.T) {
+	for _, includeUsage := range []bool{true, false} {
+		var out strings.Builder
+		require.NoError(t, roundTrip(textStream, NewOpenAIEncoder(&out, "alias", includeUsage)))
+
+		data := sseData(t, out.String())
+		assert.Equal(t, "[DONE]", data[len(data)-1], "The stream should end with [DONE]")
+		chunks := sseChunks(t, data[:len(data)-1])
+
+		var content, reasoning strings.Builder
+		var usage *openai.Usage
+		for i, chunk := range chunks {
+			assert.Equal(t, "alias", chunk.Model)
+			assert.Equal(t, chunks[0].Id, chunk.Id, "Chunks should share the ID")
+			if chunk.Usage != nil {
+				assert.Equal(t, len(chunks)-1, i, "Usage should come in the final chunk")
+				assert.Empty(t, chunk.Choices)
+				usage = chunk.Usage
+				continue
+			}
+			for _, choice := range chunk.Choices {
+				text, _ := choice.Delta.Content.(string)
+				content.WriteString(text)
+				reasoning.WriteString(choice.Delta.ReasoningContent)
+			}
+		}
+		assert.Equal(t, "assistant", chunks[0].Choices[0].Delta.Role)
+		assert.Equal(t, "Hello", content.String(), "Content after [DONE] should be ignored")
+		assert.Equal(t, "hmm", reasoning.String())
+		assert.Equal(t, "stop", *chunks[2].Choices[0].FinishReason)
+		if includeUsage {
+			require.NotNil(t, usage)
+			assert.Equal(t, openai.Usage{PromptTokens: 5, CompletionTokens: 2, TotalTokens: 7}, *usage)
+		} else {
+			assert.Nil(t, usage, "Usage should only be sent with include_usage")
+		}
+	}
+}
+
+func TestOpenAIRoundTripToolCalls(t *testing.T) {
+	var out strings.Builder
+	require.NoError(t, roundTrip(toolStream, NewOpenAIEncoder(&out, "gpt-4.1", false)))
+
+	data := sseData(t, out.String())
+	chunks := sseChunks(t, data[:len(data)-1])
+	require.Len(t, chunks, 3)
+
+	first := chunks[0].Choices[0].Delta.ToolCalls[0]
+	assert.Equal(t, "call_1", first.ID)
+	assert.Equal(t, "function", first.Type)
+	assert.Equal(t, "get_weather", first.Function.Name)
+
+	var arguments strings.Builder
+	for _, chunk := range chunks {
+		for _, call := range chunk.Choices[0].Delta.ToolCalls {
+			assert.Equal(t, 0, call.Index)
+			arguments.WriteString(call.Function.Arguments)
+		}
+	}
+	assert.Equal(t, `{"city":"Paris"}`, arguments.String())
+	assert.Equal(t, "tool_calls", *chunks[2].Choices[0].FinishReason)
+}
+
+func TestOpenAIRoundTripUpstreamError(t *testing.T) {
+	var out strings.Builder
+	err := roundTrip(failedStream, NewOpenAIEncoder(&out, "gpt-4.1", false))
+
+	var upstreamErr *openai.UpstreamError
+	require.True(t, errors.As(err, &upstreamErr))
+	assert.Equal(t, "model overloaded", upstreamErr.Err.Message)
+
+	data := sseData(t, out.String())
+	require.Len(t, data, 2)
+	assert.NotContains(t, data, "[DONE]", "A failed stream should not end with [DONE]")
+	var resp openai.ErrorResponse
+	require.NoError(t, json.Unmarshal([]byte(data[1]), &resp))
+	assert.Equal(t, "model overloaded", resp.Error.Message)
+	assert.Equal(t, "server_error", resp.Error.Type)
+}
+
+func TestOllamaRoundTrip(t *testing.T) {
+	var out strings.Builder
+	require.NoError(t, roundTrip(textStream, NewOllamaEncoder(&out, "alias", true)))
+
+	lines := ndjsonLines(t, out.String())
+	require.Len(t, lines, 4)
+	assert.Equal(t, "Hel", lines[0].Message.Content)
+	assert.Equal(t, "hmm", lines[1].Message.Thinking)
+	assert.Equal(t, "lo", lines[2].Message.Content)
+
+	last := lines[3]
+	assert.True(t, last.Done)
+	assert.Equal(t, "stop", last.DoneReason)
+	assert.Equal(t, 5, last.PromptEvalCount)
+	assert.Equal(t, 2, last.EvalCount)
+	for _, line := range lines {
+		assert.Equal(t, "alias", line.Model)
+	}
+}
+
+func TestOllamaRoundTripWithoutThinking(t *testing.T) {
+	var out strings.Builder
+	enc := NewOllamaEncoder(&out, "alias", false)
+	enc.Thinking = false
+	require.NoError(t, roundTrip(textStream, enc))
+
+	lines := ndjsonLines(t, out.String())
+	require.Len(t, lines, 1, "Non-streamed replies should be a single response")
+	assert.Equal(t, "Hello", lines[0].Message.Content)
+	assert.Empty(t, lines[0].Message.Thinking)
+	assert.True(t, lines[0].Done)
+}
+
+func TestOllamaRoundTripToolCalls(t *testing.T) {
+	var out strings.Builder
+	require.NoError(t, roundTrip(toolStream, NewOllamaEncoder(&out, "gpt-4.1", true)))
+
+	lines := ndjsonLines(t, out.String())
+	require.Len(t, lines, 2, "Tool call fragments should be sent as one call")
+	calls := lines[0].Message.ToolCalls
+	require.Len(t, calls, 1)
+	assert.Equal(t, "get_weather", calls[0].Function.Name)
+	assert.Equal(t, "Paris", calls[0].Function.Arguments["city"])
+	assert.True(t, lines[1].Done)
+	assert.Empty(t, lines[1].Message.ToolCalls)
+}
+
+func TestOllamaRoundTripUpstreamError(t *testing.T) {
+	var out strings.Builder
+	err := roundTrip(failedStream, NewOllamaEncoder(&out, "gpt-4.1", true))
+	require.Error(t, err)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.JSONEq(t, `{"error":"model overloaded"}`, lines[1])
+}
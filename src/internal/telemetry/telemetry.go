@@ -0,0 +1,103 @@
+// telemetry package wires OpenTelemetry tracing for the proxy.
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"ollama-api-proxy/src/internal/config"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const ServiceName = "ollama-api-proxy"
+
+// Span attribute keys shared by the handlers.
+var (
+	AttrModel            = attribute.Key("llm.model")
+	AttrProvider         = attribute.Key("llm.provider")
+	AttrStream           = attribute.Key("llm.stream")
+	AttrPromptTokens     = attribute.Key("llm.usage.prompt_tokens")
+	AttrCompletionTokens = attribute.Key("llm.usage.completion_tokens")
+	AttrTotalTokens      = attribute.Key("llm.usage.total_tokens")
+)
+
+// Init installs the global tracer provider and W3C propagators according to
+// the configured exporter. The returned function flushes and stops the
+// provider; it is a no-op when tracing is disabled.
+func Init(ctx context.Context, cfg *config.Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var processor sdktrace.SpanProcessor
+	switch cfg.TraceExporter {
+	case "otlp":
+		var opts []otlptracehttp.Option
+		if cfg.TraceEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpointURL(cfg.TraceEndpoint))
+		}
+		exp, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		processor = sdktrace.NewBatchSpanProcessor(exp)
+	case "file":
+		f, err := os.OpenFile(cfg.TraceFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to create file exporter: %w", err)
+		}
+		// Spans are written synchronously so the file is complete even when
+		// the process is killed.
+		processor = sdktrace.NewSimpleSpanProcessor(exp)
+	default:
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(ServiceName),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(processor),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer used for spans created inside the proxy.
+func Tracer() trace.Tracer {
+	return otel.Tracer(ServiceName)
+}
+
+// NewTransport wraps base so every upstream call gets a client span and a
+// propagated traceparent header.
+func NewTransport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(base)
+}
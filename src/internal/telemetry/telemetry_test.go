@@ -0,0 +1,83 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ollama-api-proxy/src/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// testInit installs tracing for cfg and restores the no-op provider when
+// the test ends.
+func testInit(t *testing.T, cfg *config.Config) func(context.Context) error {
+	t.Helper()
+	shutdown, err := Init(context.Background(), cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	return shutdown
+}
+
+func TestInitNone(t *testing.T) {
+	shutdown := testInit(t, config.Default())
+	assert.NoError(t, shutdown(context.Background()))
+	assert.Contains(t, otel.GetTextMapPropagator().Fields(), "traceparent", "Trace context should be propagated even without an exporter")
+}
+
+func TestInitFile(t *testing.T) {
+	cfg := config.Default()
+	cfg.TraceExporter = "file"
+	cfg.TraceFile = filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown := testInit(t, cfg)
+
+	_, span := Tracer().Start(context.Background(), "test.span")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	data, err := os.ReadFile(cfg.TraceFile)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"Name":"test.span"`)
+	assert.Contains(t, string(data), ServiceName)
+
+	cfg.TraceFile = filepath.Join(t.TempDir(), "missing", "traces.jsonl")
+	_, err = Init(context.Background(), cfg)
+	assert.ErrorContains(t, err, "failed to open trace file")
+}
+
+func TestNewTransport(t *testing.T) {
+	cfg := config.Default()
+	cfg.TraceExporter = "file"
+	cfg.TraceFile = filepath.Join(t.TempDir(), "traces.jsonl")
+	shutdown := testInit(t, cfg)
+	defer shutdown(context.Background())
+
+	headers := make(chan http.Header, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header
+	}))
+	defer server.Close()
+
+	ctx, span := Tracer().Start(context.Background(), "request")
+	defer span.End()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	resp, err := (&http.Client{Transport: NewTransport(nil)}).Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	carrier := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(<-headers))
+	upstream := trace.SpanContextFromContext(carrier)
+	assert.True(t, upstream.IsValid(), "The upstream request should carry a traceparent")
+	assert.Equal(t, span.SpanContext().TraceID(), upstream.TraceID())
+	assert.NotEqual(t, span.SpanContext().SpanID(), upstream.SpanID(), "The upstream call should get its own client span")
+}
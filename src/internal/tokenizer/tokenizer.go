@@ -0,0 +1,211 @@
+// tokenizer package counts prompt tokens offline. It uses tiktoken BPE files
+// from a local directory when they are available and falls back to a
+// character-based estimate otherwise.
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"ollama-api-proxy/src/internal/dto/newapi"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// Encoding names accepted by the tokenizer model setting.
+const (
+	EncodingO200K    = "o200k_base"
+	EncodingCL100K   = "cl100k_base"
+	EncodingEstimate = "estimate"
+)
+
+// Tokens added per message and to prime the reply, as counted by OpenAI
+// for chat models.
+const (
+	tokensPerMessage = 3
+	tokensPerReply   = 3
+)
+
+// encodingSpec holds the split pattern and special tokens of an encoding,
+// as defined by tiktoken.
+type encodingSpec struct {
+	pattern string
+	special map[string]int
+}
+
+var encodingSpecs = map[string]encodingSpec{
+	EncodingO200K: {
+		pattern: strings.Join([]string{
+			`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]*[\p{Ll}\p{Lm}\p{Lo}\p{M}]+(?i:'s|'t|'re|'ve|'m|'ll|'d)?`,
+			`[^\r\n\p{L}\p{N}]?[\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}]+[\p{Ll}\p{Lm}\p{Lo}\p{M}]*(?i:'s|'t|'re|'ve|'m|'ll|'d)?`,
+			`\p{N}{1,3}`,
+			` ?[^\s\p{L}\p{N}]+[\r\n/]*`,
+			`\s*[\r\n]+`,
+			`\s+(?!\S)`,
+			`\s+`,
+		}, "|"),
+		special: map[string]int{
+			tiktoken.ENDOFTEXT:   199999,
+			tiktoken.ENDOFPROMPT: 200018,
+		},
+	},
+	EncodingCL100K: {
+		pattern: `(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+`,
+		special: map[string]int{
+			tiktoken.ENDOFTEXT:   100257,
+			tiktoken.FIM_PREFIX:  100258,
+			tiktoken.FIM_MIDDLE:  100259,
+			tiktoken.FIM_SUFFIX:  100260,
+			tiktoken.ENDOFPROMPT: 100276,
+		},
+	},
+}
+
+// Tokenizer counts tokens with locally available BPE encodings. A nil
+// Tokenizer only estimates.
+type Tokenizer struct {
+	dir       string
+	mu        sync.Mutex
+	encodings map[string]*tiktoken.Tiktoken
+}
+
+// New returns a tokenizer that loads "<encoding>.tiktoken" files from dir.
+// The files are never downloaded.
+func New(dir string) *Tokenizer {
+	return &Tokenizer{dir: dir, encodings: make(map[string]*tiktoken.Tiktoken)}
+}
+
+// EncodingForModel returns the encoding used by an upstream model, or
+// EncodingEstimate when it is not an OpenAI model.
+func EncodingForModel(model string) string {
+	model = strings.ToLower(model)
+	switch {
+	case strings.HasPrefix(model, "gpt-4o"), strings.HasPrefix(model, "gpt-4.1"), strings.HasPrefix(model, "gpt-5"),
+		strings.HasPrefix(model, "o1"), strings.HasPrefix(model, "o3"), strings.HasPrefix(model, "o4"):
+		return EncodingO200K
+	case strings.HasPrefix(model, "gpt-4"), strings.HasPrefix(model, "gpt-3.5"):
+		return EncodingCL100K
+	default:
+		return EncodingEstimate
+	}
+}
+
+// Count returns the number of tokens in text and whether the count is exact.
+func (t *Tokenizer) Count(encoding, text string) (int, bool) {
+	if enc := t.encoding(encoding); enc != nil {
+		return len(enc.EncodeOrdinary(text)), true
+	}
+	return Estimate(text), false
+}
+
+// CountMessages returns the number of prompt tokens of a chat request and
+// whether the count is exact.
+func (t *Tokenizer) CountMessages(encoding string, messages []newapi.Message) (int, bool) {
+	total, exact := tokensPerReply, true
+	for i := range messages {
+		n, ok := t.CountMessage(encoding, &messages[i])
+		total += n
+		exact = exact && ok
+	}
+	return total, exact
+}
+
+// CountMessage returns the number of tokens a single message adds to the
+// prompt and whether the count is exact.
+func (t *Tokenizer) CountMessage(encoding string, message *newapi.Message) (int, bool) {
+	total, exact := t.Count(encoding, message.Role+message.StringContent())
+	total += tokensPerMessage
+	if message.Name != nil {
+		n, _ := t.Count(encoding, *message.Name)
+		total += n + 1
+	}
+	if len(message.ToolCalls) > 0 {
+		n, _ := t.Count(encoding, string(message.ToolCalls))
+		total += n
+	}
+	return total, exact
+}
+
+// Estimate approximates the token count of text at four characters per
+// token, rounded up.
+func Estimate(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+func (t *Tokenizer) encoding(name string) *tiktoken.Tiktoken {
+	if t == nil || name == "" || name == EncodingEstimate {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if enc, loaded := t.encodings[name]; loaded {
+		return enc
+	}
+	enc, err := t.load(name)
+	if err != nil {
+		slog.Warn("Tokenizer encoding unavailable, estimating token counts", "encoding", name, "error", err)
+	}
+	// A failed load is remembered so it is only logged once.
+	t.encodings[name] = enc
+	return enc
+}
+
+// load builds an encoding from its BPE file in the tokenizer's directory.
+// The encodings are built here rather than by tiktoken.GetEncoding, whose
+// loader and cache are global to the process.
+func (t *Tokenizer) load(name string) (*tiktoken.Tiktoken, error) {
+	spec, ok := encodingSpecs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding '%s'", name)
+	}
+	ranks, err := loadRanks(filepath.Join(t.dir, name+".tiktoken"))
+	if err != nil {
+		return nil, err
+	}
+	bpe, err := tiktoken.NewCoreBPE(ranks, spec.special, spec.pattern)
+	if err != nil {
+		return nil, err
+	}
+	specialSet := make(map[string]any, len(spec.special))
+	for token := range spec.special {
+		specialSet[token] = true
+	}
+	encoding := &tiktoken.Encoding{Name: name, PatStr: spec.pattern, MergeableRanks: ranks, SpecialTokens: spec.special}
+	return tiktoken.NewTiktoken(bpe, encoding, specialSet), nil
+}
+
+// loadRanks reads a tiktoken BPE file of base64 tokens and their ranks.
+func loadRanks(name string) (map[string]int, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		token, rank, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			return nil, fmt.Errorf("invalid token in %s: %w", name, err)
+		}
+		n, err := strconv.Atoi(rank)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rank in %s: %w", name, err)
+		}
+		ranks[string(decoded)] = n
+	}
+	return ranks, scanner.Err()
+}
@@ -0,0 +1,94 @@
+package tokenizer
+
+import (
+	"testing"
+
+	"ollama-api-proxy/src/internal/dto/newapi"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testdata/cl100k_base.tiktoken only holds the 256 single-byte tokens, so
+// exact counts are byte counts.
+
+func message(role, content string) newapi.Message {
+	m := newapi.Message{Role: role}
+	m.SetStringContent(content)
+	return m
+}
+
+func TestEncodingForModel(t *testing.T) {
+	tests := map[string]string{
+		"gpt-4.1-mini":  EncodingO200K,
+		"GPT-4o":        EncodingO200K,
+		"o3":            EncodingO200K,
+		"gpt-4":         EncodingCL100K,
+		"gpt-3.5-turbo": EncodingCL100K,
+		"claude-sonnet": EncodingEstimate,
+	}
+	for model, encoding := range tests {
+		assert.Equal(t, encoding, EncodingForModel(model), model)
+	}
+}
+
+func TestCount(t *testing.T) {
+	tok := New("testdata")
+	tests := []struct {
+		name     string
+		tok      *Tokenizer
+		encoding string
+		text     string
+		want     int
+		exact    bool
+	}{
+		{"exact", tok, EncodingCL100K, "hello world", 11, true},
+		{"exact multibyte", tok, EncodingCL100K, "héllo", 6, true},
+		{"estimate encoding", tok, EncodingEstimate, "hello world", 3, false},
+		{"missing file", tok, EncodingO200K, "hello world", 3, false},
+		{"nil tokenizer", nil, EncodingCL100K, "hello world", 3, false},
+		{"estimate counts runes", tok, EncodingEstimate, "héllo", 2, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, exact := tt.tok.Count(tt.encoding, tt.text)
+			assert.Equal(t, tt.want, n)
+			assert.Equal(t, tt.exact, exact)
+		})
+	}
+}
+
+func TestCountMessages(t *testing.T) {
+	tok := New("testdata")
+	name := "bob"
+	named := message("user", "hi")
+	named.Name = &name
+
+	tests := []struct {
+		name     string
+		encoding string
+		messages []newapi.Message
+		want     int
+		exact    bool
+	}{
+		// 3 to prime the reply, 3 per message plus "userhello".
+		{"exact", EncodingCL100K, []newapi.Message{message("user", "hello")}, 3 + 3 + 9, true},
+		{"exact with name", EncodingCL100K, []newapi.Message{named}, 3 + 3 + 6 + 3 + 1, true},
+		{"exact two messages", EncodingCL100K, []newapi.Message{message("system", "be"), message("user", "hi")}, 3 + 3 + 8 + 3 + 6, true},
+		{"estimate", EncodingEstimate, []newapi.Message{message("user", "hello")}, 3 + 3 + 3, false},
+		{"empty", EncodingCL100K, nil, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, exact := tok.CountMessages(tt.encoding, tt.messages)
+			assert.Equal(t, tt.want, n)
+			assert.Equal(t, tt.exact, exact)
+		})
+	}
+}
+
+func TestTokenizersAreIndependent(t *testing.T) {
+	_, exact := New("testdata").Count(EncodingCL100K, "hello")
+	assert.True(t, exact)
+	_, exact = New(t.TempDir()).Count(EncodingCL100K, "hello")
+	assert.False(t, exact, "A tokenizer should only use the files of its own directory")
+}